@@ -13,6 +13,9 @@ import (
 
 var object *models.Object
 
+// 通过 HTTP 提供启动文件的根目录, 为空时不提供
+var bootRoot string
+
 // @Title DHCP 动态配置 API
 // @Description 为 DHCP 服务器提供的简单的 restful api
 // @Contact.email 2803660215@qq.com
@@ -22,7 +25,8 @@ var object *models.Object
 // @License.url http://www.apache.org/licenses/LICENSE-2.0.html
 
 // @BasePath
-func API(socket string, d *server.DHCPDConfig, logLevel logger.LogLevel, connMaxLifetime time.Duration) {
+func API(socket, httpBootRoot string, d *server.DHCPDConfig, logLevel logger.LogLevel, connMaxLifetime time.Duration) {
+	bootRoot = httpBootRoot
 	object = models.MustConnectDB(d.DBUser, d.DBHost, d.DBPass, d.DBName, d.DBPort, logLevel, d.DBPoolMaxIdleConns, d.DBPoolMaxOpenConns, connMaxLifetime)
 	route(socket)
 }
@@ -31,22 +35,47 @@ func route(socket string) {
 	r := gin.Default()
 	url := ginSwagger.URL("/swagger/doc.json")
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
+	r.GET("/boot/*filepath", bootFile)
+	r.HEAD("/boot/*filepath", bootFile)
 	v1 := r.Group("/api/v1")
 
 	v1.GET("/inform/:tag/", inform)
 
 	v1.POST("/set/options/", setOptions)
+	v1.POST("/set/subnet/", setSubnet)
 	v1.POST("/set/bind/", setBind)
+	v1.POST("/set/relaybind/", setRelayBind)
 	v1.POST("/set/acl/", setACL)
 	v1.POST("/set/reserve/", setReserve)
+	v1.POST("/set/customoption/", setCustomOption)
+	v1.POST("/set/class/", setClientClass)
+	v1.POST("/set/archboot/", setArchBoot)
+	v1.POST("/set/pxemenu/", setPXEMenuItem)
+	v1.POST("/set/profile/", setProfile)
 
 	v1.PUT("/update/options/", updateOptions)
+	v1.PUT("/update/subnet/", updateSubnet)
 	v1.PUT("/update/bind/", updateBind)
+	v1.PUT("/update/relaybind/", updateRelayBind)
 	v1.PUT("/update/acl/", updateACL)
+	v1.PUT("/update/customoption/", updateCustomOption)
+	v1.PUT("/update/class/", updateClientClass)
+	v1.PUT("/update/archboot/", updateArchBoot)
+	v1.PUT("/update/pxemenu/", updatePXEMenuItem)
+	v1.PUT("/update/profile/", updateProfile)
+	v1.PUT("/update/bindstate/", updateBindState)
 
+	v1.DELETE("/del/subnet/", deleteSubnet)
 	v1.DELETE("/del/bind/", deleteBind)
+	v1.DELETE("/del/relaybind/", deleteRelayBind)
 	v1.DELETE("/del/acl/", deleteACL)
 	v1.DELETE("/del/reserve/", deleteReserve)
+	v1.DELETE("/del/conflict/", deleteConflict)
+	v1.DELETE("/del/customoption/", deleteCustomOption)
+	v1.DELETE("/del/class/", deleteClientClass)
+	v1.DELETE("/del/archboot/", deleteArchBoot)
+	v1.DELETE("/del/pxemenu/", deletePXEMenuItem)
+	v1.DELETE("/del/profile/", deleteProfile)
 
 	if err := r.Run(socket); err != nil {
 		panic(err)
@@ -46,13 +46,54 @@ var doc = `{
                         "description": "通过 mac 地址匹配需要删除的 acl 规则",
                         "name": "mac",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "通过 client identifier 匹配需要删除的 acl 规则",
+                        "name": "client_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/archboot/": {
+            "delete": {
+                "description": "删除架构启动配置",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "删除架构启动配置",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "地址池名称(留空表示全局配置)",
+                        "name": "subnet",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "客户端架构类型",
+                        "name": "arch",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
@@ -80,13 +121,217 @@ var doc = `{
                         "description": "通过 ip 地址匹配需要删除的绑定规则(mac 或者 ip 至少指定一项)",
                         "name": "ip",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "通过 client identifier 匹配需要删除的绑定规则",
+                        "name": "client_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/class/": {
+            "delete": {
+                "description": "删除客户端分类",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "删除客户端分类",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "客户端分类名称",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/conflict/": {
+            "delete": {
+                "description": "清除冲突地址, 清除之后地址可以被再次分配",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "清除冲突地址",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通过 ip 地址清除冲突地址",
+                        "name": "ip",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/customoption/": {
+            "delete": {
+                "description": "删除自定义选项",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "删除自定义选项",
+                "parameters": [
+                    {
+                        "enum": [
+                            "global",
+                            "subnet",
+                            "binding"
+                        ],
+                        "type": "string",
+                        "description": "作用范围",
+                        "name": "scope",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "地址池名称, mac 地址或者 client identifier(scope 为 global 时留空)",
+                        "name": "target",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "选项代码",
+                        "name": "code",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/profile/": {
+            "delete": {
+                "description": "删除安装配置, 仍被绑定引用的安装配置不能删除",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "删除安装配置",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "安装配置名称",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/pxemenu/": {
+            "delete": {
+                "description": "删除 PXE 启动菜单项",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "删除 PXE 启动菜单项",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "地址池名称(留空表示全局菜单项)",
+                        "name": "subnet",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "启动服务器类型",
+                        "name": "type",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/relaybind/": {
+            "delete": {
+                "description": "删除交换机端口绑定",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "删除交换机端口绑定",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通过绑定的 ip 地址删除交换机端口绑定",
+                        "name": "ip",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
@@ -114,7 +359,36 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/del/subnet/": {
+            "delete": {
+                "description": "删除地址池(已分配的租约在到期之后才会被删除)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "删除地址池",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通过名称删除地址池",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
@@ -134,23 +408,42 @@ var doc = `{
                     {
                         "enum": [
                             "options",
+                            "subnet",
                             "leases",
+                            "conflict",
                             "acl",
                             "bind",
-                            "reserve"
+                            "relaybind",
+                            "reserve",
+                            "customoption",
+                            "class",
+                            "archboot",
+                            "pxemenu",
+                            "profile",
+                            "tftp"
                         ],
                         "type": "string",
                         "description": "配置项",
                         "name": "tag",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "enum": [
+                            "offered",
+                            "bound"
+                        ],
+                        "type": "string",
+                        "description": "只返回指定状态的租约(tag 为 leases 时有效)",
+                        "name": "state",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
@@ -173,7 +466,7 @@ var doc = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/restful.ACL"
+                            "$ref": "#/definitions/models.ACL"
                         }
                     }
                 ],
@@ -181,30 +474,30 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
             }
         },
-        "/api/v1/set/bind/": {
+        "/api/v1/set/archboot/": {
             "post": {
-                "description": "mac 地址绑定(已被分配的地址需要等待客户端释放之后才能绑定)",
+                "description": "根据客户端架构类型(option 93)选择启动文件和 next-server, subnet 留空表示适用于所有地址池\n常用的架构类型: 0(BIOS), 7/9(UEFI x86-64), 11(UEFI ARM64), 16(UEFI x86-64 HTTP)",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "添加 mac 地址绑定",
+                "summary": "添加架构启动配置",
                 "parameters": [
                     {
-                        "description": "添加 mac 地址绑定",
+                        "description": "添加架构启动配置",
                         "name": "message",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/restful.Binding"
+                            "$ref": "#/definitions/models.ArchBoot"
                         }
                     }
                 ],
@@ -212,30 +505,30 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
             }
         },
-        "/api/v1/set/options/": {
+        "/api/v1/set/bind/": {
             "post": {
-                "description": "添加 dhcpd 核心配置, 包括地址, 路由, DNS等的分配",
+                "description": "mac 地址绑定(已被分配的地址需要等待客户端释放之后才能绑定)",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "添加 dhcpd 核心配置",
+                "summary": "添加 mac 地址绑定",
                 "parameters": [
                     {
-                        "description": "添加 dhcpd 核心配置",
+                        "description": "添加 mac 地址绑定",
                         "name": "message",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/restful.Options"
+                            "$ref": "#/definitions/models.Binding"
                         }
                     }
                 ],
@@ -243,30 +536,30 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
             }
         },
-        "/api/v1/set/reserve/": {
+        "/api/v1/set/class/": {
             "post": {
-                "description": "添加保留地址(已被分配的地址需要等待客户端释放之后才能被设置为保留地址)",
+                "description": "添加客户端分类, 根据匹配表达式(如: vendor_class prefix \"PXEClient\" and oui == \"00:50:56\")为客户端指定地址段, 启动文件和 acl 动作",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "添加保留地址",
+                "summary": "添加客户端分类",
                 "parameters": [
                     {
-                        "description": "添加保留地址",
+                        "description": "添加客户端分类",
                         "name": "message",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/restful.Reserves"
+                            "$ref": "#/definitions/models.ClientClass"
                         }
                     }
                 ],
@@ -274,30 +567,30 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
             }
         },
-        "/api/v1/update/acl/": {
-            "put": {
-                "description": "修改 acl 规则(acl规则必须在options中打开acl设置才能生效)",
+        "/api/v1/set/customoption/": {
+            "post": {
+                "description": "添加自定义 DHCP 选项, 作用范围为 global, subnet(target 为地址池名称) 或者 binding(target 为 mac 地址或者 client identifier)\n值类型为 ip, ip-list, string, uint8, uint16, uint32, bool, hex",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "修改 acl 规则",
+                "summary": "添加自定义选项",
                 "parameters": [
                     {
-                        "description": "修改 acl 规则",
+                        "description": "添加自定义选项",
                         "name": "message",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/restful.ACL"
+                            "$ref": "#/definitions/models.CustomOption"
                         }
                     }
                 ],
@@ -305,30 +598,30 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
             }
         },
-        "/api/v1/update/bind/": {
-            "put": {
-                "description": "mac 地址绑定(已被分配的地址需要等待客户端释放之后才能绑定)",
+        "/api/v1/set/options/": {
+            "post": {
+                "description": "添加 dhcpd 核心配置, 包括地址, 路由, DNS等的分配",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "修改 mac 地址绑定",
+                "summary": "添加 dhcpd 核心配置",
                 "parameters": [
                     {
-                        "description": "修改 mac 地址绑定",
+                        "description": "添加 dhcpd 核心配置",
                         "name": "message",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/restful.Binding"
+                            "$ref": "#/definitions/models.Options"
                         }
                     }
                 ],
@@ -336,30 +629,30 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
             }
         },
-        "/api/v1/update/options/": {
-            "put": {
-                "description": "修改 dhcpd 核心配置, 包括地址, 路由, DNS等的分配",
+        "/api/v1/set/profile/": {
+            "post": {
+                "description": "添加安装配置, 绑定引用安装配置后根据模板生成客户端的 pxelinux.cfg/01-\u003cmac\u003e, grub.cfg-01-\u003cmac\u003e 和 kickstart/\u003cmac\u003e\n客户端的启动文件根据架构从安装配置的 boot_file_name(BIOS) 或者 efi_boot_file_name(UEFI) 中选择, 修改绑定的 profile 即可重新安装其他系统\n模板可用的变量: MAC, IP, Hostname, Arch, Profile, Kernel, Initrd, KernelArgs",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "修改 dhcpd 核心配置",
+                "summary": "添加安装配置",
                 "parameters": [
                     {
-                        "description": "修改 dhcpd 核心配置",
+                        "description": "添加安装配置",
                         "name": "message",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/restful.Options"
+                            "$ref": "#/definitions/models.Profile"
                         }
                     }
                 ],
@@ -367,26 +660,540 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/restful.ResMsg"
+                            "$ref": "#/definitions/api.ResMsg"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "restful.ACL": {
-            "type": "object",
-            "properties": {
-                "action": {
-                    "type": "string"
-                },
-                "client_hw_addr": {
-                    "type": "string"
-                }
+        },
+        "/api/v1/set/pxemenu/": {
+            "post": {
+                "description": "添加 PXE 启动菜单项, subnet 留空表示适用于所有地址池, type 为 0 表示从本地磁盘启动",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "添加 PXE 启动菜单项",
+                "parameters": [
+                    {
+                        "description": "添加 PXE 启动菜单项",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PXEMenuItem"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/set/relaybind/": {
+            "post": {
+                "description": "根据中继代理信息(option 82)中的 circuit-id 和 remote-id 绑定地址(remote_id 留空表示匹配任意交换机)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "添加交换机端口绑定",
+                "parameters": [
+                    {
+                        "description": "添加交换机端口绑定",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RelayBinding"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/set/reserve/": {
+            "post": {
+                "description": "添加保留地址(已被分配的地址需要等待客户端释放之后才能被设置为保留地址)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "添加保留地址",
+                "parameters": [
+                    {
+                        "description": "添加保留地址",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Reserves"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/set/subnet/": {
+            "post": {
+                "description": "添加地址池(作用域), 留空的配置项继承 options 中的全局配置",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "添加地址池",
+                "parameters": [
+                    {
+                        "description": "添加地址池",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Subnet"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/acl/": {
+            "put": {
+                "description": "修改 acl 规则(acl规则必须在options中打开acl设置才能生效)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改 acl 规则",
+                "parameters": [
+                    {
+                        "description": "修改 acl 规则",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ACL"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/archboot/": {
+            "put": {
+                "description": "修改架构启动配置, 通过 subnet 和 arch 匹配需要修改的配置",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改架构启动配置",
+                "parameters": [
+                    {
+                        "description": "修改架构启动配置",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ArchBoot"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/bind/": {
+            "put": {
+                "description": "mac 地址绑定(已被分配的地址需要等待客户端释放之后才能绑定)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改 mac 地址绑定",
+                "parameters": [
+                    {
+                        "description": "修改 mac 地址绑定",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Binding"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/bindstate/": {
+            "put": {
+                "description": "安装程序完成安装之后调用, 将 installing 状态的绑定设置为 installed, 之后客户端从本地磁盘启动\n只使用连接的源地址(不使用 X-Forwarded-For)匹配绑定的地址, 如 kickstart 的 %post 中: curl -X PUT \"http://10.1.1.1:8888/api/v1/update/bindstate/\"\n重新安装(pending-install)或者启动救援系统(rescue)通过 /api/v1/update/bind/ 修改",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "标记安装完成",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/class/": {
+            "put": {
+                "description": "修改客户端分类",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改客户端分类",
+                "parameters": [
+                    {
+                        "description": "修改客户端分类",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ClientClass"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/customoption/": {
+            "put": {
+                "description": "修改自定义 DHCP 选项, 通过 scope, target 和 code 匹配需要修改的选项",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改自定义选项",
+                "parameters": [
+                    {
+                        "description": "修改自定义选项",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CustomOption"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/options/": {
+            "put": {
+                "description": "修改 dhcpd 核心配置, 包括地址, 路由, DNS等的分配",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改 dhcpd 核心配置",
+                "parameters": [
+                    {
+                        "description": "修改 dhcpd 核心配置",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Options"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/profile/": {
+            "put": {
+                "description": "修改安装配置",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改安装配置",
+                "parameters": [
+                    {
+                        "description": "修改安装配置",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Profile"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/pxemenu/": {
+            "put": {
+                "description": "修改 PXE 启动菜单项, 通过 subnet 和 type 匹配需要修改的菜单项",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改 PXE 启动菜单项",
+                "parameters": [
+                    {
+                        "description": "修改 PXE 启动菜单项",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PXEMenuItem"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/relaybind/": {
+            "put": {
+                "description": "根据中继代理信息(option 82)中的 circuit-id 和 remote-id 绑定地址(remote_id 留空表示匹配任意交换机)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改交换机端口绑定",
+                "parameters": [
+                    {
+                        "description": "修改交换机端口绑定",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RelayBinding"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/update/subnet/": {
+            "put": {
+                "description": "修改地址池(作用域), 留空的配置项继承 options 中的全局配置",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "修改地址池",
+                "parameters": [
+                    {
+                        "description": "修改地址池",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Subnet"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/boot/{filepath}": {
+            "get": {
+                "description": "为 UEFI HTTP 启动客户端和 iPXE 提供内核, initrd, ISO 等启动文件, 支持 Range 请求\n绑定了安装配置的客户端的 pxelinux.cfg/01-\u003cmac\u003e, grub.cfg-01-\u003cmac\u003e 和 kickstart/\u003cmac\u003e 根据模板生成",
+                "summary": "下载启动文件",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "启动文件路径(相对于 --http-boot-root)",
+                        "name": "filepath",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": ""
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.ResMsg": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "data": {
+                    "type": "object"
+                },
+                "error": {
+                    "type": "object"
+                },
+                "success": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.ACL": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "client_hw_addr": {
+                    "type": "string"
+                },
+                "client_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ArchBoot": {
+            "type": "object",
+            "required": [
+                "boot_file_name"
+            ],
+            "properties": {
+                "arch": {
+                    "type": "integer"
+                },
+                "boot_file_name": {
+                    "type": "string"
+                },
+                "next_server": {
+                    "type": "string"
+                },
+                "subnet": {
+                    "type": "string"
+                }
             }
         },
-        "restful.Binding": {
+        "models.Binding": {
             "type": "object",
             "properties": {
                 "bind_addr": {
@@ -394,16 +1201,89 @@ var doc = `{
                 },
                 "client_hw_addr": {
                     "type": "string"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "hostname": {
+                    "description": "分配给客户端的主机名(option 12), 留空时使用地址池的主机名模板",
+                    "type": "string"
+                },
+                "ipxe_script_url": {
+                    "description": "iPXE 启动脚本地址, 留空时使用地址池的配置",
+                    "type": "string"
+                },
+                "profile": {
+                    "description": "安装配置名称, 设置时为客户端生成 pxelinux.cfg/01-\u003cmac\u003e 和 grub.cfg-01-\u003cmac\u003e",
+                    "type": "string"
+                },
+                "state": {
+                    "description": "安装状态, 添加绑定时留空为 pending-install, 修改绑定时留空表示保留原来的状态",
+                    "type": "string"
+                }
+            }
+        },
+        "models.ClientClass": {
+            "type": "object",
+            "required": [
+                "match",
+                "name"
+            ],
+            "properties": {
+                "action": {
+                    "description": "开启 ACL 时, 与 ACLAction 相同的动作对所有匹配的客户端生效(allow or deny), 留空表示不参与 ACL",
+                    "type": "string"
+                },
+                "boot_file_name": {
+                    "description": "匹配的客户端使用的启动文件, 留空时使用地址池的配置",
+                    "type": "string"
+                },
+                "match": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "ranges": {
+                    "description": "匹配的客户端从这些地址段中分配地址, 格式与 Subnet.Ranges 相同, 不在客户端所在地址池子网中的地址段被忽略",
+                    "type": "string"
+                }
+            }
+        },
+        "models.CustomOption": {
+            "type": "object",
+            "required": [
+                "code",
+                "scope",
+                "type"
+            ],
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
                 }
             }
         },
-        "restful.Options": {
+        "models.Options": {
             "type": "object",
             "required": [
                 "acl",
                 "boot_file_name",
                 "dns",
-                "gateway_ip",
                 "lease_time",
                 "net_mask",
                 "range_end_ip",
@@ -422,24 +1302,106 @@ var doc = `{
                 "boot_file_name": {
                     "type": "string"
                 },
+                "broadcast_addr": {
+                    "description": "广播地址(option 28), 留空时根据子网计算, 全局配置只对默认地址池有效",
+                    "type": "string"
+                },
+                "classless_routes": {
+                    "description": "无类别静态路由(option 121, 以及微软客户端使用的 option 249), 格式为 目的网络:网关, 多条路由以逗号(,)分隔\n如: 10.0.0.0/8:10.1.1.1,0.0.0.0/0:10.1.1.254, 客户端收到此选项之后会忽略 option 3, 所以需要包含默认路由",
+                    "type": "string"
+                },
+                "client_key": {
+                    "description": "识别客户端的方式\nclient_id: 客户端发送了 client identifier(option 61) 时优先使用 client identifier, 否则使用硬件地址(chaddr)\nhw_addr: 只使用硬件地址",
+                    "type": "string"
+                },
+                "decline_hold_time": {
+                    "description": "冲突地址(被客户端拒绝或者分配前探测到已被使用)在此时间内不会被再次分配",
+                    "type": "string"
+                },
                 "dns": {
                     "type": "string"
                 },
+                "domain_name": {
+                    "description": "域名(option 15)",
+                    "type": "string"
+                },
+                "domain_search": {
+                    "description": "域名搜索列表(option 119), 多个域名以逗号(,)分隔",
+                    "type": "string"
+                },
                 "gateway_ip": {
+                    "description": "已废弃, 响应中的 giaddr 由中继代理填写, 服务器只会原样返回",
+                    "type": "string"
+                },
+                "hostname_pattern": {
+                    "description": "没有绑定主机名的客户端使用此模板生成主机名(option 12), 留空表示不为客户端分配主机名\n{mac} 替换为不带分隔符的 mac 地址, {ip} 替换为以 - 分隔的 IP 地址, 如: pxe-{mac}, node-{ip}",
+                    "type": "string"
+                },
+                "http_boot_url": {
+                    "description": "UEFI HTTP 启动客户端(option 60 为 HTTPClient)使用的启动文件地址, 如: http://10.1.1.1:8888/boot/shimx64.efi\n以 / 结尾时作为目录, 根据客户端架构添加默认的启动文件(如: grubx64.efi)",
+                    "type": "string"
+                },
+                "ipxe_script_url": {
+                    "description": "iPXE 客户端(option 77 为 iPXE 或者发送了 option 175)使用的启动脚本地址, 如: http://10.1.1.1/boot.ipxe\n留空时 iPXE 客户端与其他客户端使用相同的启动文件",
                     "type": "string"
                 },
                 "lease_time": {
                     "type": "string"
                 },
+                "max_lease_time": {
+                    "type": "string"
+                },
+                "min_lease_time": {
+                    "description": "客户端请求的租约时间(option 51)被限制在此范围之内, 两者都留空时忽略客户端请求的租约时间",
+                    "type": "string"
+                },
+                "mtu": {
+                    "description": "接口 MTU(option 26)",
+                    "type": "string"
+                },
                 "net_mask": {
                     "type": "string"
                 },
+                "ntp_servers": {
+                    "description": "NTP 服务器(option 42), 多个地址以逗号(,)分隔",
+                    "type": "string"
+                },
+                "offer_hold_time": {
+                    "description": "发送 DHCPOFFER 之后为客户端保留地址的时间, 客户端在此时间内没有发送 DHCPREQUEST 则地址被回收",
+                    "type": "string"
+                },
+                "ping_check": {
+                    "description": "分配地址之前是否通过 ICMP echo 和 ARP(直连网段) 检查地址是否已被使用",
+                    "type": "boolean"
+                },
+                "ping_timeout": {
+                    "type": "string"
+                },
+                "pxe_discovery_control": {
+                    "description": "PXE_DISCOVERY_CONTROL(子选项 6), 0-255\nbit 0: 禁止广播发现启动服务器, bit 1: 禁止多播发现, bit 2: 只使用 PXE_BOOT_SERVERS 中的启动服务器\nbit 3: 已经提供启动文件时直接下载启动文件, 不显示启动菜单和提示",
+                    "type": "string"
+                },
+                "pxe_menu_prompt": {
+                    "description": "启动菜单的提示信息(子选项 10)",
+                    "type": "string"
+                },
+                "pxe_menu_timeout": {
+                    "description": "启动菜单的超时时间(秒), 0 表示立即选择第一个菜单项, 255 表示一直等待用户选择",
+                    "type": "string"
+                },
                 "range_end_ip": {
                     "type": "string"
                 },
                 "range_start_ip": {
                     "type": "string"
                 },
+                "rebinding_time": {
+                    "type": "string"
+                },
+                "renewal_time": {
+                    "description": "续约时间(T1)和重新绑定时间(T2), 留空时分别为租约时间的 50% 和 87.5%",
+                    "type": "string"
+                },
                 "router": {
                     "type": "string"
                 },
@@ -448,30 +1410,188 @@ var doc = `{
                 }
             }
         },
-        "restful.ResMsg": {
+        "models.PXEMenuItem": {
             "type": "object",
+            "required": [
+                "description"
+            ],
             "properties": {
-                "code": {
+                "boot_file_name": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "server": {
+                    "type": "string"
+                },
+                "subnet": {
+                    "type": "string"
+                },
+                "type": {
                     "type": "integer"
+                }
+            }
+        },
+        "models.Profile": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "architectures": {
+                    "type": "string"
                 },
-                "data": {
-                    "type": "object"
+                "boot_args": {
+                    "type": "string"
                 },
-                "error": {
-                    "type": "object"
+                "boot_file_name": {
+                    "type": "string"
                 },
-                "success": {
-                    "type": "boolean"
+                "efi_boot_file_name": {
+                    "type": "string"
+                },
+                "grub_template": {
+                    "type": "string"
+                },
+                "initrd": {
+                    "type": "string"
+                },
+                "kernel": {
+                    "type": "string"
+                },
+                "kickstart_template": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "pxelinux_template": {
+                    "type": "string"
+                },
+                "rescue_args": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.RelayBinding": {
+            "type": "object",
+            "properties": {
+                "bind_addr": {
+                    "type": "string"
+                },
+                "circuit_id": {
+                    "type": "string"
+                },
+                "remote_id": {
+                    "type": "string"
                 }
             }
         },
-        "restful.Reserves": {
+        "models.Reserves": {
             "type": "object",
             "properties": {
                 "address": {
                     "type": "string"
                 }
             }
+        },
+        "models.Subnet": {
+            "type": "object",
+            "required": [
+                "cidr",
+                "name",
+                "ranges"
+            ],
+            "properties": {
+                "boot_file_name": {
+                    "type": "string"
+                },
+                "broadcast_addr": {
+                    "description": "广播地址(option 28), 留空时根据子网计算, 全局配置只对默认地址池有效",
+                    "type": "string"
+                },
+                "cidr": {
+                    "type": "string"
+                },
+                "classless_routes": {
+                    "description": "无类别静态路由(option 121, 以及微软客户端使用的 option 249), 格式为 目的网络:网关, 多条路由以逗号(,)分隔\n如: 10.0.0.0/8:10.1.1.1,0.0.0.0/0:10.1.1.254, 客户端收到此选项之后会忽略 option 3, 所以需要包含默认路由",
+                    "type": "string"
+                },
+                "dns": {
+                    "type": "string"
+                },
+                "domain_name": {
+                    "description": "域名(option 15)",
+                    "type": "string"
+                },
+                "domain_search": {
+                    "description": "域名搜索列表(option 119), 多个域名以逗号(,)分隔",
+                    "type": "string"
+                },
+                "hostname_pattern": {
+                    "description": "没有绑定主机名的客户端使用此模板生成主机名, 格式与 Options.HostnamePattern 相同",
+                    "type": "string"
+                },
+                "http_boot_url": {
+                    "description": "UEFI HTTP 启动客户端使用的启动文件地址",
+                    "type": "string"
+                },
+                "ipxe_script_url": {
+                    "description": "iPXE 客户端使用的启动脚本地址",
+                    "type": "string"
+                },
+                "lease_time": {
+                    "type": "string"
+                },
+                "max_lease_time": {
+                    "type": "string"
+                },
+                "min_lease_time": {
+                    "description": "客户端请求的租约时间(option 51)被限制在此范围之内, 两者都留空时忽略客户端请求的租约时间",
+                    "type": "string"
+                },
+                "mtu": {
+                    "description": "接口 MTU(option 26)",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "ntp_servers": {
+                    "description": "NTP 服务器(option 42), 多个地址以逗号(,)分隔",
+                    "type": "string"
+                },
+                "pxe_discovery_control": {
+                    "description": "PXE_DISCOVERY_CONTROL(子选项 6), 0-255\nbit 0: 禁止广播发现启动服务器, bit 1: 禁止多播发现, bit 2: 只使用 PXE_BOOT_SERVERS 中的启动服务器\nbit 3: 已经提供启动文件时直接下载启动文件, 不显示启动菜单和提示",
+                    "type": "string"
+                },
+                "pxe_menu_prompt": {
+                    "description": "启动菜单的提示信息(子选项 10)",
+                    "type": "string"
+                },
+                "pxe_menu_timeout": {
+                    "description": "启动菜单的超时时间(秒), 0 表示立即选择第一个菜单项, 255 表示一直等待用户选择",
+                    "type": "string"
+                },
+                "ranges": {
+                    "description": "可分配的地址段, 多个地址段以逗号(,)分隔, 如: 10.1.1.10-10.1.1.100,10.1.1.150-10.1.1.200",
+                    "type": "string"
+                },
+                "rebinding_time": {
+                    "type": "string"
+                },
+                "renewal_time": {
+                    "description": "续约时间(T1)和重新绑定时间(T2), 留空时分别为租约时间的 50% 和 87.5%",
+                    "type": "string"
+                },
+                "router": {
+                    "type": "string"
+                },
+                "server_ip": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -17,15 +17,37 @@ func aclReply(resMsg *ResMsg) {
 	}
 }
 
-func leasesReply(resMsg *ResMsg) () {
+func subnetReply(resMsg *ResMsg) {
+	var subnets []models.Subnet
+	if err := object.Db.Find(&subnets).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = subnets
+}
+
+func leasesReply(resMsg *ResMsg, state string) () {
 	var leases []models.Leases
-	if err := object.Db.Find(&leases).Error; err != nil {
+	db := object.Db
+	if state != "" {
+		db = db.Where("state = ?", state)
+	}
+	if err := db.Find(&leases).Error; err != nil {
 		resMsg.Error = err.Error()
 	}
 	resMsg.Success = true
 	resMsg.Data = leases
 }
 
+func conflictReply(resMsg *ResMsg) {
+	var conflicts []models.Conflicts
+	if err := object.Db.Find(&conflicts).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = conflicts
+}
+
 func bindReply(resMsg *ResMsg) {
 	var bind []models.Binding
 	if err := object.Db.Find(&bind).Error; err != nil {
@@ -35,6 +57,60 @@ func bindReply(resMsg *ResMsg) {
 	resMsg.Data = bind
 }
 
+func relayBindReply(resMsg *ResMsg) {
+	var relayBind []models.RelayBinding
+	if err := object.Db.Find(&relayBind).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = relayBind
+}
+
+func customOptionReply(resMsg *ResMsg) {
+	var customOptions []models.CustomOption
+	if err := object.Db.Find(&customOptions).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = customOptions
+}
+
+func clientClassReply(resMsg *ResMsg) {
+	var classes []models.ClientClass
+	if err := object.Db.Order("priority, name").Find(&classes).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = classes
+}
+
+func archBootReply(resMsg *ResMsg) {
+	var archBoots []models.ArchBoot
+	if err := object.Db.Order("subnet, arch").Find(&archBoots).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = archBoots
+}
+
+func profileReply(resMsg *ResMsg) {
+	var profiles []models.Profile
+	if err := object.Db.Order("name").Find(&profiles).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = profiles
+}
+
+func pxeMenuReply(resMsg *ResMsg) {
+	var items []models.PXEMenuItem
+	if err := object.Db.Order("subnet, type").Find(&items).Error; err != nil {
+		resMsg.Error = err.Error()
+	}
+	resMsg.Success = true
+	resMsg.Data = items
+}
+
 func reserveReply(resMsg *ResMsg) () {
 	var reserves []models.Reserves
 	if err := object.Db.Find(&reserves).Error; err != nil {
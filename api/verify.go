@@ -1,33 +1,175 @@
 package api
 
 import (
+	"dhcp/bootcfg"
 	"dhcp/models"
+	"dhcp/server"
+	"encoding/hex"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"net"
 	"net/http"
+	"time"
 )
 
+// 客户端必须通过合法的 mac 地址或者 client identifier(十六进制字符串) 指定, 两者只需要指定一项
+func validClient(clientHWAddr, clientID string) bool {
+	if clientID != "" {
+		if _, err := hex.DecodeString(clientID); err != nil {
+			return false
+		}
+		if clientHWAddr == "" {
+			return true
+		}
+	}
+	_, err := net.ParseMAC(clientHWAddr)
+	return err == nil
+}
+
+// 绑定的安装状态是否合法, 留空表示不修改(新的绑定为 pending-install)
+func validBindState(state string) bool {
+	switch state {
+	case "", models.BindStatePendingInstall, models.BindStateInstalling, models.BindStateInstalled, models.BindStateRescue:
+		return true
+	}
+	return false
+}
+
 func verifyOptions(c *gin.Context, options models.Options, resMsg ResMsg) bool {
 	if options.ACL && !(options.ACLAction == "allow" || options.ACLAction == "deny") {
 		resMsg.Error = "Error enable acl without specifying acl action (allow|deny)"
 		c.JSON(http.StatusOK, resMsg)
 		return false
 	}
+
+	if options.OfferHoldTime != "" {
+		if _, err := time.ParseDuration(options.OfferHoldTime); err != nil {
+			resMsg.Error = "invalid offer hold time " + err.Error()
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+
+	if options.DeclineHoldTime != "" {
+		if _, err := time.ParseDuration(options.DeclineHoldTime); err != nil {
+			resMsg.Error = "invalid decline hold time " + err.Error()
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+
+	if options.PingTimeout != "" {
+		if _, err := time.ParseDuration(options.PingTimeout); err != nil {
+			resMsg.Error = "invalid ping timeout " + err.Error()
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+
+	if options.ClientKey != "" && options.ClientKey != models.ClientKeyClientID && options.ClientKey != models.ClientKeyHWAddr {
+		resMsg.Error = "client key in (client_id|hw_addr)"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	if err := server.CheckNetworkOptions(&options.NetworkOptions); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	if err := server.CheckPXEOptions(&options.PXEOptions); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	for _, field := range []string{options.IPXEScriptURL, options.HTTPBootURL} {
+		if err := server.CheckBootURL(field); err != nil {
+			resMsg.Error = err.Error()
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+
+	if err := server.CheckHostnamePattern(options.HostnamePattern); err != nil {
+		resMsg.Error = "invalid hostname pattern " + err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	for _, field := range []string{options.RenewalTime, options.RebindingTime, options.MinLeaseTime, options.MaxLeaseTime} {
+		if field == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(field); err != nil {
+			resMsg.Error = "invalid renewal, rebinding or lease time range " + err.Error()
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+	if err := server.CheckLeaseTimeRange(options.LeaseTime, options.MinLeaseTime, options.MaxLeaseTime); err != nil {
+		resMsg.Error = "invalid lease time range " + err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+	return true
+}
+
+func verifySubnet(c *gin.Context, subnet models.Subnet, resMsg ResMsg) bool {
+	if err := server.CheckSubnet(&subnet); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
 	return true
 }
 
 func verifyBind(c *gin.Context, bind models.Binding, resMsg ResMsg) bool {
-	// ip 和 mac 是否合法
-	_, err := net.ParseMAC(bind.ClientHWAddr)
-	if net.ParseIP(bind.BindAddr) == nil || err != nil {
-		resMsg.Error = "invalid mac address or invalid bind address"
+	// ip 和 mac(或 client identifier) 是否合法
+	if net.ParseIP(bind.BindAddr) == nil || !validClient(bind.ClientHWAddr, bind.ClientID) {
+		resMsg.Error = "invalid mac address, client id or invalid bind address"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	if bind.Hostname != "" {
+		if err := server.CheckHostname(bind.Hostname); err != nil {
+			resMsg.Error = err.Error()
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+
+	if err := server.CheckBootURL(bind.IPXEScriptURL); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	if !validBindState(bind.State) {
+		resMsg.Error = "invalid bind state, state in (pending-install|installing|installed|rescue)"
 		c.JSON(http.StatusOK, resMsg)
 		return false
 	}
 
-	// 是否已被分配
-	if err := object.Db.Where("assigned_addr = ?", bind.BindAddr).First(&models.Leases{}).Error; err != gorm.ErrRecordNotFound {
+	// 安装配置是否存在
+	if bind.Profile != "" {
+		if err := object.Db.Where("name = ?", bind.Profile).First(&models.Profile{}).Error; err != nil {
+			resMsg.Error = "profile does not exist"
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+
+	// 是否已被其他客户端分配, 绑定的客户端自己持有的租约不影响修改绑定
+	query := object.Db.Where("assigned_addr = ?", bind.BindAddr)
+	if bind.ClientID != "" {
+		query = query.Where("client_id <> ?", bind.ClientID)
+	} else if hw, err := net.ParseMAC(bind.ClientHWAddr); err == nil {
+		query = query.Where("client_hw_addr <> ?", hw.String())
+	}
+	if err := query.First(&models.Leases{}).Error; err != gorm.ErrRecordNotFound {
 		resMsg.Error = "bind address assigned"
 		c.JSON(http.StatusOK, resMsg)
 		return false
@@ -39,6 +181,36 @@ func verifyBind(c *gin.Context, bind models.Binding, resMsg ResMsg) bool {
 		c.JSON(http.StatusOK, resMsg)
 		return false
 	}
+
+	// 是否已被绑定到交换机端口
+	if err := object.Db.Where("bind_addr = ?", bind.BindAddr).First(&models.RelayBinding{}).Error; err != gorm.ErrRecordNotFound {
+		resMsg.Error = "the binding address has been bound to the relay agent"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+	return true
+}
+
+func verifyRelayBind(c *gin.Context, relayBind models.RelayBinding, resMsg ResMsg) bool {
+	if net.ParseIP(relayBind.BindAddr) == nil || relayBind.CircuitID == "" {
+		resMsg.Error = "invalid bind address or empty circuit id"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	// 是否是保留地址
+	if err := object.Db.Where("address = ?", relayBind.BindAddr).First(&models.Reserves{}).Error; err != gorm.ErrRecordNotFound {
+		resMsg.Error = "the binding address is a reserved address"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	// 是否已被绑定到 mac 地址
+	if err := object.Db.Where("bind_addr = ?", relayBind.BindAddr).First(&models.Binding{}).Error; err != gorm.ErrRecordNotFound {
+		resMsg.Error = "the binding address has been bound to the client"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
 	return true
 }
 
@@ -49,8 +221,75 @@ func verifyACL(c *gin.Context, acl models.ACL, resMsg ResMsg) bool {
 		return false
 	}
 
-	_, err := net.ParseMAC(acl.ClientHWAddr)
-	if err != nil {
+	if !validClient(acl.ClientHWAddr, acl.ClientID) {
+		resMsg.Error = "invalid mac address or client id"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+	return true
+}
+
+// 检查自定义选项, 同时将绑定的目标转换为查询时使用的格式
+func verifyCustomOption(c *gin.Context, option *models.CustomOption, resMsg ResMsg) bool {
+	if err := server.CheckCustomOption(option); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+	return true
+}
+
+func verifyClientClass(c *gin.Context, class models.ClientClass, resMsg ResMsg) bool {
+	if err := server.CheckClientClass(&class); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+	return true
+}
+
+func verifyArchBoot(c *gin.Context, archBoot models.ArchBoot, resMsg ResMsg) bool {
+	if err := server.CheckArchBoot(&archBoot); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	// 地址池是否存在
+	if archBoot.Subnet != "" {
+		if err := object.Db.Where("name = ?", archBoot.Subnet).First(&models.Subnet{}).Error; err != nil {
+			resMsg.Error = "subnet does not exist"
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+	return true
+}
+
+func verifyPXEMenuItem(c *gin.Context, item models.PXEMenuItem, resMsg ResMsg) bool {
+	if err := server.CheckPXEMenuItem(&item); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+
+	// 地址池是否存在
+	if item.Subnet != "" {
+		if err := object.Db.Where("name = ?", item.Subnet).First(&models.Subnet{}).Error; err != nil {
+			resMsg.Error = "subnet does not exist"
+			c.JSON(http.StatusOK, resMsg)
+			return false
+		}
+	}
+
+	// 地址池的全部菜单项需要能够编码到 option 43 中
+	var items []models.PXEMenuItem
+	if err := object.Db.Where("subnet = ? and type <> ?", item.Subnet, item.Type).Find(&items).Error; err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+	if err := server.CheckPXEMenu(append(items, item)); err != nil {
 		resMsg.Error = err.Error()
 		c.JSON(http.StatusOK, resMsg)
 		return false
@@ -76,5 +315,20 @@ func verifyReserve(c *gin.Context, reserve models.Reserves, resMsg ResMsg) bool
 		c.JSON(http.StatusOK, resMsg)
 		return false
 	}
+
+	if err := object.Db.Where("bind_addr = ?", reserve.Address).First(&models.RelayBinding{}).Error; err != gorm.ErrRecordNotFound {
+		resMsg.Error = "the reserved address has been bound to the relay agent"
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
+	return true
+}
+
+func verifyProfile(c *gin.Context, profile models.Profile, resMsg ResMsg) bool {
+	if err := bootcfg.CheckProfile(&profile); err != nil {
+		resMsg.Error = err.Error()
+		c.JSON(http.StatusOK, resMsg)
+		return false
+	}
 	return true
 }
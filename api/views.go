@@ -1,13 +1,19 @@
 package api
 
 import (
+	"bytes"
+	"dhcp/bootcfg"
 	"dhcp/models"
 	"dhcp/server"
+	"dhcp/tftp"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"net"
 	"net/http"
+	"path"
+	"strconv"
+	"time"
 )
 
 type ResMsg struct {
@@ -40,11 +46,25 @@ func respError(c *gin.Context, err interface{}) {
 	c.JSON(http.StatusOK, resMsg)
 }
 
+// 保存主键中包含可以为空的字段(如 client_id)的记录, 不存在时插入, 存在时更新
+// 主键存在零值时 gorm 的 Save 总是插入新的记录, 所以按照 query 指定的完整主键判断记录是否存在
+func saveRecord(value interface{}, query string, args ...interface{}) error {
+	var count int64
+	if err := object.Db.Model(value).Where(query, args...).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return object.Db.Create(value).Error
+	}
+	return object.Db.Model(value).Where(query, args...).Select("*").Updates(value).Error
+}
+
 // @Summary 查询当前 DHCPD 配置信息
 // @Description 查询当前 DHCPD 配置信息
 // @Produce  json
 // @Accept json
-// @Param tag path string true "配置项" Enums(options, leases, acl, bind, reserve)
+// @Param tag path string true "配置项" Enums(options, subnet, leases, conflict, acl, bind, relaybind, reserve, customoption, class, archboot, pxemenu, profile, tftp)
+// @Param state query string false "只返回指定状态的租约(tag 为 leases 时有效)" Enums(offered, bound)
 // @Success 200 {object} ResMsg
 // @Router /api/v1/inform/{tag} [get]
 func inform(c *gin.Context) {
@@ -54,14 +74,33 @@ func inform(c *gin.Context) {
 	case "options":
 		resMsg.Success = true
 		resMsg.Data = server.QueryOptions()
+	case "subnet":
+		subnetReply(&resMsg)
 	case "leases":
-		leasesReply(&resMsg)
+		leasesReply(&resMsg, c.Query("state"))
+	case "conflict":
+		conflictReply(&resMsg)
 	case "acl":
 		aclReply(&resMsg)
 	case "bind":
 		bindReply(&resMsg)
+	case "relaybind":
+		relayBindReply(&resMsg)
 	case "reserve":
 		reserveReply(&resMsg)
+	case "customoption":
+		customOptionReply(&resMsg)
+	case "class":
+		clientClassReply(&resMsg)
+	case "archboot":
+		archBootReply(&resMsg)
+	case "pxemenu":
+		pxeMenuReply(&resMsg)
+	case "profile":
+		profileReply(&resMsg)
+	case "tftp":
+		resMsg.Success = true
+		resMsg.Data = tftp.QueryStats()
 	default:
 		resMsg.Error = "unknown inform"
 	}
@@ -72,7 +111,7 @@ func inform(c *gin.Context) {
 // @Description 添加 dhcpd 核心配置, 包括地址, 路由, DNS等的分配
 // @Produce  json
 // @Accept json
-// @Param message body Options true "添加 dhcpd 核心配置"
+// @Param message body models.Options true "添加 dhcpd 核心配置"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/set/options/ [post]
 func setOptions(c *gin.Context) {
@@ -103,11 +142,37 @@ func setOptions(c *gin.Context) {
 	}
 }
 
+// @Summary 添加地址池
+// @Description 添加地址池(作用域), 留空的配置项继承 options 中的全局配置
+// @Produce  json
+// @Accept json
+// @Param message body models.Subnet true "添加地址池"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/set/subnet/ [post]
+func setSubnet(c *gin.Context) {
+	var resMsg ResMsg
+	var subnet models.Subnet
+	if !verifyShouldBindJSON(c, &subnet) {
+		return
+	}
+
+	if !verifySubnet(c, subnet, resMsg) {
+		return
+	}
+
+	if err := object.Db.Create(&subnet).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
 // @Summary 添加 mac 地址绑定
 // @Description mac 地址绑定(已被分配的地址需要等待客户端释放之后才能绑定)
 // @Produce  json
 // @Accept json
-// @Param message body Binding true "添加 mac 地址绑定"
+// @Param message body models.Binding true "添加 mac 地址绑定"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/set/bind/ [post]
 func setBind(c *gin.Context) {
@@ -121,6 +186,9 @@ func setBind(c *gin.Context) {
 		return
 	}
 
+	if bind.State == "" {
+		bind.State = models.BindStatePendingInstall
+	}
 	if err := object.Db.Create(&bind).Error; err != nil {
 		respError(c, err)
 		return
@@ -129,11 +197,37 @@ func setBind(c *gin.Context) {
 	respSuccess(c, "success")
 }
 
+// @Summary 添加交换机端口绑定
+// @Description 根据中继代理信息(option 82)中的 circuit-id 和 remote-id 绑定地址(remote_id 留空表示匹配任意交换机)
+// @Produce  json
+// @Accept json
+// @Param message body models.RelayBinding true "添加交换机端口绑定"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/set/relaybind/ [post]
+func setRelayBind(c *gin.Context) {
+	var resMsg ResMsg
+	var relayBind models.RelayBinding
+	if !verifyShouldBindJSON(c, &relayBind) {
+		return
+	}
+
+	if !verifyRelayBind(c, relayBind, resMsg) {
+		return
+	}
+
+	if err := object.Db.Create(&relayBind).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
 // @Summary 添加 acl 规则
 // @Description 添加 acl 规则(acl规则必须在options中打开acl设置才能生效)
 // @Produce  json
 // @Accept json
-// @Param message body ACL true "添加 acl 规则"
+// @Param message body models.ACL true "添加 acl 规则"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/set/acl/ [post]
 func setACL(c *gin.Context) {
@@ -160,7 +254,7 @@ func setACL(c *gin.Context) {
 // @Description 添加保留地址(已被分配的地址需要等待客户端释放之后才能被设置为保留地址)
 // @Produce  json
 // @Accept json
-// @Param message body Reserves true "添加保留地址"
+// @Param message body models.Reserves true "添加保留地址"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/set/reserve/ [post]
 func setReserve(c *gin.Context) {
@@ -182,11 +276,145 @@ func setReserve(c *gin.Context) {
 	respSuccess(c, "success")
 }
 
+// @Summary 添加自定义选项
+// @Description 添加自定义 DHCP 选项, 作用范围为 global, subnet(target 为地址池名称) 或者 binding(target 为 mac 地址或者 client identifier)
+// @Description 值类型为 ip, ip-list, string, uint8, uint16, uint32, bool, hex
+// @Produce  json
+// @Accept json
+// @Param message body models.CustomOption true "添加自定义选项"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/set/customoption/ [post]
+func setCustomOption(c *gin.Context) {
+	var resMsg ResMsg
+	var option models.CustomOption
+	if !verifyShouldBindJSON(c, &option) {
+		return
+	}
+
+	if !verifyCustomOption(c, &option, resMsg) {
+		return
+	}
+
+	if err := object.Db.Create(&option).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
+// @Summary 添加客户端分类
+// @Description 添加客户端分类, 根据匹配表达式(如: vendor_class prefix "PXEClient" and oui == "00:50:56")为客户端指定地址段, 启动文件和 acl 动作
+// @Produce  json
+// @Accept json
+// @Param message body models.ClientClass true "添加客户端分类"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/set/class/ [post]
+func setClientClass(c *gin.Context) {
+	var resMsg ResMsg
+	var class models.ClientClass
+	if !verifyShouldBindJSON(c, &class) {
+		return
+	}
+
+	if !verifyClientClass(c, class, resMsg) {
+		return
+	}
+
+	if err := object.Db.Create(&class).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
+// @Summary 添加安装配置
+// @Description 添加安装配置, 绑定引用安装配置后根据模板生成客户端的 pxelinux.cfg/01-<mac>, grub.cfg-01-<mac> 和 kickstart/<mac>
+// @Description 客户端的启动文件根据架构从安装配置的 boot_file_name(BIOS) 或者 efi_boot_file_name(UEFI) 中选择, 修改绑定的 profile 即可重新安装其他系统
+// @Description 模板可用的变量: MAC, IP, Hostname, Arch, Profile, Kernel, Initrd, KernelArgs
+// @Produce  json
+// @Accept json
+// @Param message body models.Profile true "添加安装配置"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/set/profile/ [post]
+func setProfile(c *gin.Context) {
+	var resMsg ResMsg
+	var profile models.Profile
+	if !verifyShouldBindJSON(c, &profile) {
+		return
+	}
+
+	if !verifyProfile(c, profile, resMsg) {
+		return
+	}
+
+	if err := object.Db.Create(&profile).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
+// @Summary 添加架构启动配置
+// @Description 根据客户端架构类型(option 93)选择启动文件和 next-server, subnet 留空表示适用于所有地址池
+// @Description 常用的架构类型: 0(BIOS), 7/9(UEFI x86-64), 11(UEFI ARM64), 16(UEFI x86-64 HTTP)
+// @Produce  json
+// @Accept json
+// @Param message body models.ArchBoot true "添加架构启动配置"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/set/archboot/ [post]
+func setArchBoot(c *gin.Context) {
+	var resMsg ResMsg
+	var archBoot models.ArchBoot
+	if !verifyShouldBindJSON(c, &archBoot) {
+		return
+	}
+
+	if !verifyArchBoot(c, archBoot, resMsg) {
+		return
+	}
+
+	if err := object.Db.Create(&archBoot).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
+// @Summary 添加 PXE 启动菜单项
+// @Description 添加 PXE 启动菜单项, subnet 留空表示适用于所有地址池, type 为 0 表示从本地磁盘启动
+// @Produce  json
+// @Accept json
+// @Param message body models.PXEMenuItem true "添加 PXE 启动菜单项"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/set/pxemenu/ [post]
+func setPXEMenuItem(c *gin.Context) {
+	var resMsg ResMsg
+	var item models.PXEMenuItem
+	if !verifyShouldBindJSON(c, &item) {
+		return
+	}
+
+	if !verifyPXEMenuItem(c, item, resMsg) {
+		return
+	}
+
+	if err := object.Db.Create(&item).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
 // @Summary 修改 dhcpd 核心配置
 // @Description 修改 dhcpd 核心配置, 包括地址, 路由, DNS等的分配
 // @Produce  json
 // @Accept json
-// @Param message body Options true "修改 dhcpd 核心配置"
+// @Param message body models.Options true "修改 dhcpd 核心配置"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/update/options/ [put]
 func updateOptions(c *gin.Context) {
@@ -208,11 +436,36 @@ func updateOptions(c *gin.Context) {
 	respSuccess(c, "success")
 }
 
+// @Summary 修改地址池
+// @Description 修改地址池(作用域), 留空的配置项继承 options 中的全局配置
+// @Produce  json
+// @Accept json
+// @Param message body models.Subnet true "修改地址池"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/subnet/ [put]
+func updateSubnet(c *gin.Context) {
+	var resMsg ResMsg
+	var subnet models.Subnet
+	if !verifyShouldBindJSON(c, &subnet) {
+		return
+	}
+
+	if !verifySubnet(c, subnet, resMsg) {
+		return
+	}
+
+	if err := object.Db.Save(&subnet).Error; err != nil {
+		respError(c, err.Error())
+		return
+	}
+	respSuccess(c, "success")
+}
+
 // @Summary 修改 mac 地址绑定
 // @Description mac 地址绑定(已被分配的地址需要等待客户端释放之后才能绑定)
 // @Produce  json
 // @Accept json
-// @Param message body Binding true "修改 mac 地址绑定"
+// @Param message body models.Binding true "修改 mac 地址绑定"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/update/bind/ [put]
 func updateBind(c *gin.Context) {
@@ -226,7 +479,69 @@ func updateBind(c *gin.Context) {
 		return
 	}
 
-	if err := object.Db.Save(&bind).Error; err != nil {
+	// 没有指定安装状态时保留已经保存的状态, 避免重新安装已经安装完成的客户端
+	if bind.State == "" {
+		var stored models.Binding
+		bind.State = models.BindStatePendingInstall
+		if err := object.Db.Where("client_hw_addr = ? and client_id = ?", bind.ClientHWAddr, bind.ClientID).First(&stored).Error; err == nil {
+			bind.State = stored.State
+		}
+	}
+	if err := saveRecord(&bind, "client_hw_addr = ? and client_id = ?", bind.ClientHWAddr, bind.ClientID); err != nil {
+		respError(c, err.Error())
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 标记安装完成
+// @Description 安装程序完成安装之后调用, 将 installing 状态的绑定设置为 installed, 之后客户端从本地磁盘启动
+// @Description 只使用连接的源地址(不使用 X-Forwarded-For)匹配绑定的地址, 如 kickstart 的 %post 中: curl -X PUT "http://10.1.1.1:8888/api/v1/update/bindstate/"
+// @Description 重新安装(pending-install)或者启动救援系统(rescue)通过 /api/v1/update/bind/ 修改
+// @Produce  json
+// @Accept json
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/bindstate/ [put]
+func updateBindState(c *gin.Context) {
+	// 使用连接的源地址, 不信任 X-Forwarded-For 等可以伪造的请求头
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+
+	result := object.Db.Model(&models.Binding{}).
+		Where("bind_addr = ? and state = ?", host, models.BindStateInstalling).
+		Update("state", models.BindStateInstalled)
+	if result.Error != nil {
+		respError(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		respError(c, fmt.Sprintf("no installing bind for %s", host))
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 修改交换机端口绑定
+// @Description 根据中继代理信息(option 82)中的 circuit-id 和 remote-id 绑定地址(remote_id 留空表示匹配任意交换机)
+// @Produce  json
+// @Accept json
+// @Param message body models.RelayBinding true "修改交换机端口绑定"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/relaybind/ [put]
+func updateRelayBind(c *gin.Context) {
+	var resMsg ResMsg
+	var relayBind models.RelayBinding
+	if !verifyShouldBindJSON(c, &relayBind) {
+		return
+	}
+
+	if !verifyRelayBind(c, relayBind, resMsg) {
+		return
+	}
+
+	if err := object.Db.Save(&relayBind).Error; err != nil {
 		respError(c, err.Error())
 		return
 	}
@@ -237,7 +552,7 @@ func updateBind(c *gin.Context) {
 // @Description 修改 acl 规则(acl规则必须在options中打开acl设置才能生效)
 // @Produce  json
 // @Accept json
-// @Param message body ACL true "修改 acl 规则"
+// @Param message body models.ACL true "修改 acl 规则"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/update/acl/ [put]
 func updateACL(c *gin.Context) {
@@ -251,25 +566,182 @@ func updateACL(c *gin.Context) {
 		return
 	}
 
-	if err := object.Db.Save(&acl).Error; err != nil {
+	if err := saveRecord(&acl, "client_hw_addr = ? and client_id = ?", acl.ClientHWAddr, acl.ClientID); err != nil {
+		respError(c, err.Error())
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 修改自定义选项
+// @Description 修改自定义 DHCP 选项, 通过 scope, target 和 code 匹配需要修改的选项
+// @Produce  json
+// @Accept json
+// @Param message body models.CustomOption true "修改自定义选项"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/customoption/ [put]
+func updateCustomOption(c *gin.Context) {
+	var resMsg ResMsg
+	var option models.CustomOption
+	if !verifyShouldBindJSON(c, &option) {
+		return
+	}
+
+	if !verifyCustomOption(c, &option, resMsg) {
+		return
+	}
+
+	if err := saveRecord(&option, "scope = ? and target = ? and code = ?", option.Scope, option.Target, option.Code); err != nil {
+		respError(c, err.Error())
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 修改安装配置
+// @Description 修改安装配置
+// @Produce  json
+// @Accept json
+// @Param message body models.Profile true "修改安装配置"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/profile/ [put]
+func updateProfile(c *gin.Context) {
+	var resMsg ResMsg
+	var profile models.Profile
+	if !verifyShouldBindJSON(c, &profile) {
+		return
+	}
+
+	if !verifyProfile(c, profile, resMsg) {
+		return
+	}
+
+	if err := object.Db.Save(&profile).Error; err != nil {
+		respError(c, err)
+		return
+	}
+
+	respSuccess(c, "success")
+}
+
+// @Summary 修改客户端分类
+// @Description 修改客户端分类
+// @Produce  json
+// @Accept json
+// @Param message body models.ClientClass true "修改客户端分类"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/class/ [put]
+func updateClientClass(c *gin.Context) {
+	var resMsg ResMsg
+	var class models.ClientClass
+	if !verifyShouldBindJSON(c, &class) {
+		return
+	}
+
+	if !verifyClientClass(c, class, resMsg) {
+		return
+	}
+
+	if err := object.Db.Save(&class).Error; err != nil {
+		respError(c, err.Error())
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 修改架构启动配置
+// @Description 修改架构启动配置, 通过 subnet 和 arch 匹配需要修改的配置
+// @Produce  json
+// @Accept json
+// @Param message body models.ArchBoot true "修改架构启动配置"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/archboot/ [put]
+func updateArchBoot(c *gin.Context) {
+	var resMsg ResMsg
+	var archBoot models.ArchBoot
+	if !verifyShouldBindJSON(c, &archBoot) {
+		return
+	}
+
+	if !verifyArchBoot(c, archBoot, resMsg) {
+		return
+	}
+
+	if err := saveRecord(&archBoot, "subnet = ? and arch = ?", archBoot.Subnet, archBoot.Arch); err != nil {
+		respError(c, err.Error())
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 修改 PXE 启动菜单项
+// @Description 修改 PXE 启动菜单项, 通过 subnet 和 type 匹配需要修改的菜单项
+// @Produce  json
+// @Accept json
+// @Param message body models.PXEMenuItem true "修改 PXE 启动菜单项"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/update/pxemenu/ [put]
+func updatePXEMenuItem(c *gin.Context) {
+	var resMsg ResMsg
+	var item models.PXEMenuItem
+	if !verifyShouldBindJSON(c, &item) {
+		return
+	}
+
+	if !verifyPXEMenuItem(c, item, resMsg) {
+		return
+	}
+
+	if err := saveRecord(&item, "subnet = ? and type = ?", item.Subnet, item.Type); err != nil {
 		respError(c, err.Error())
 		return
 	}
 	respSuccess(c, "success")
 }
 
+// @Summary 删除地址池
+// @Description 删除地址池(已分配的租约在到期之后才会被删除)
+// @Produce  json
+// @Accept json
+// @Param name query string true "通过名称删除地址池"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/subnet/ [delete]
+func deleteSubnet(c *gin.Context) {
+	name := c.Request.FormValue("name")
+	if name == "" {
+		respError(c, "please specify the subnet name")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("name = ?", name).Delete(&models.Subnet{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
 // @Summary 删除匹配的 mac 地址绑定规则
 // @Description 删除匹配的 mac 地址绑定规则
 // @Produce  json
 // @Accept json
 // @Param mac query string false "通过 mac 地址匹配需要删除的绑定规则(mac 或者 ip 至少指定一项)"
 // @Param ip query string false "通过 ip 地址匹配需要删除的绑定规则(mac 或者 ip 至少指定一项)"
+// @Param client_id query string false "通过 client identifier 匹配需要删除的绑定规则"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/del/bind/ [delete]
 func deleteBind(c *gin.Context) {
 	mac := c.Request.FormValue("mac")
 	ip := c.Request.FormValue("ip")
 
+	if clientID := c.Request.FormValue("client_id"); clientID != "" {
+		if err := object.Db.Unscoped().Where("client_id = ?", clientID).Delete(&models.Binding{}).Error; err != nil {
+			respError(c, err)
+			return
+		}
+		respSuccess(c, "success")
+		return
+	}
+
 	_, err := net.ParseMAC(mac)
 	if net.ParseIP(ip) == nil && err != nil {
 		respError(c, "please specify a valid mac or ip")
@@ -302,14 +774,45 @@ func deleteBind(c *gin.Context) {
 	return
 }
 
+// @Summary 删除交换机端口绑定
+// @Description 删除交换机端口绑定
+// @Produce  json
+// @Accept json
+// @Param ip query string true "通过绑定的 ip 地址删除交换机端口绑定"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/relaybind/ [delete]
+func deleteRelayBind(c *gin.Context) {
+	ip := c.Request.FormValue("ip")
+	if net.ParseIP(ip) == nil {
+		respError(c, "invalid ip address")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("bind_addr = ?", ip).Delete(&models.RelayBinding{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
 // @Summary 删除匹配的 acl 规则
 // @Description 删除匹配的 acl 规则
 // @Produce  json
 // @Accept json
 // @Param mac query string false "通过 mac 地址匹配需要删除的 acl 规则"
+// @Param client_id query string false "通过 client identifier 匹配需要删除的 acl 规则"
 // @Success 200 {object} ResMsg
 // @Router /api/v1/del/acl/ [delete]
 func deleteACL(c *gin.Context) {
+	if clientID := c.Request.FormValue("client_id"); clientID != "" {
+		if err := object.Db.Unscoped().Where("client_id = ?", clientID).Delete(&models.ACL{}).Error; err != nil {
+			respError(c, err)
+			return
+		}
+		respSuccess(c, "success")
+		return
+	}
+
 	mac := c.Request.FormValue("mac")
 	if _, err := net.ParseMAC(mac); err != nil {
 		respError(c, err)
@@ -343,3 +846,179 @@ func deleteReserve(c *gin.Context) {
 	}
 	respSuccess(c, "success")
 }
+
+// @Summary 清除冲突地址
+// @Description 清除冲突地址, 清除之后地址可以被再次分配
+// @Produce  json
+// @Accept json
+// @Param ip query string true "通过 ip 地址清除冲突地址"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/conflict/ [delete]
+func deleteConflict(c *gin.Context) {
+	ip := c.Request.FormValue("ip")
+	if net.ParseIP(ip) == nil {
+		respError(c, "invalid ip address")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("address = ?", ip).Delete(&models.Conflicts{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 删除自定义选项
+// @Description 删除自定义选项
+// @Produce  json
+// @Accept json
+// @Param scope query string true "作用范围" Enums(global, subnet, binding)
+// @Param target query string false "地址池名称, mac 地址或者 client identifier(scope 为 global 时留空)"
+// @Param code query int true "选项代码"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/customoption/ [delete]
+func deleteCustomOption(c *gin.Context) {
+	scope := c.Request.FormValue("scope")
+	target := c.Request.FormValue("target")
+	code, err := strconv.ParseUint(c.Request.FormValue("code"), 10, 8)
+	if scope == "" || err != nil {
+		respError(c, "please specify the scope and a valid option code")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("scope = ? and target = ? and code = ?", scope, target, code).Delete(&models.CustomOption{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 删除安装配置
+// @Description 删除安装配置, 仍被绑定引用的安装配置不能删除
+// @Produce  json
+// @Accept json
+// @Param name query string true "安装配置名称"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/profile/ [delete]
+func deleteProfile(c *gin.Context) {
+	name := c.Request.FormValue("name")
+	if name == "" {
+		respError(c, "please specify the profile name")
+		return
+	}
+
+	if err := object.Db.Where("profile = ?", name).First(&models.Binding{}).Error; err != gorm.ErrRecordNotFound {
+		respError(c, "profile is referenced by bindings")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("name = ?", name).Delete(&models.Profile{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 删除客户端分类
+// @Description 删除客户端分类
+// @Produce  json
+// @Accept json
+// @Param name query string true "客户端分类名称"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/class/ [delete]
+func deleteClientClass(c *gin.Context) {
+	name := c.Request.FormValue("name")
+	if name == "" {
+		respError(c, "please specify the client class name")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("name = ?", name).Delete(&models.ClientClass{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 删除架构启动配置
+// @Description 删除架构启动配置
+// @Produce  json
+// @Accept json
+// @Param subnet query string false "地址池名称(留空表示全局配置)"
+// @Param arch query int true "客户端架构类型"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/archboot/ [delete]
+func deleteArchBoot(c *gin.Context) {
+	subnet := c.Request.FormValue("subnet")
+	arch, err := strconv.ParseUint(c.Request.FormValue("arch"), 10, 16)
+	if err != nil {
+		respError(c, "please specify a valid arch")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("subnet = ? and arch = ?", subnet, arch).Delete(&models.ArchBoot{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 删除 PXE 启动菜单项
+// @Description 删除 PXE 启动菜单项
+// @Produce  json
+// @Accept json
+// @Param subnet query string false "地址池名称(留空表示全局菜单项)"
+// @Param type query int true "启动服务器类型"
+// @Success 200 {object} ResMsg
+// @Router /api/v1/del/pxemenu/ [delete]
+func deletePXEMenuItem(c *gin.Context) {
+	subnet := c.Request.FormValue("subnet")
+	itemType, err := strconv.ParseUint(c.Request.FormValue("type"), 10, 16)
+	if err != nil {
+		respError(c, "please specify a valid type")
+		return
+	}
+
+	if err := object.Db.Unscoped().Where("subnet = ? and type = ?", subnet, itemType).Delete(&models.PXEMenuItem{}).Error; err != nil {
+		respError(c, err)
+		return
+	}
+	respSuccess(c, "success")
+}
+
+// @Summary 下载启动文件
+// @Description 为 UEFI HTTP 启动客户端和 iPXE 提供内核, initrd, ISO 等启动文件, 支持 Range 请求
+// @Description 绑定了安装配置的客户端的 pxelinux.cfg/01-<mac>, grub.cfg-01-<mac> 和 kickstart/<mac> 根据模板生成
+// @Param filepath path string true "启动文件路径(相对于 --http-boot-root)"
+// @Success 200
+// @Router /boot/{filepath} [get]
+func bootFile(c *gin.Context) {
+	// http.Dir 不允许通过 .. 访问根目录以外的文件
+	name := path.Clean("/" + c.Param("filepath"))
+	if data, ok := bootcfg.Render(name); ok {
+		http.ServeContent(c.Writer, c.Request, path.Base(name), time.Time{}, bytes.NewReader(data))
+		// HEAD 请求和 Range 请求不表示客户端已经获取了启动配置
+		if c.Request.Method == http.MethodGet && c.Writer.Status() == http.StatusOK {
+			bootcfg.Delivered(name)
+		}
+		return
+	}
+	if bootRoot == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	file, err := http.Dir(bootRoot).Open(name)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
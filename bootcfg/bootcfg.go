@@ -0,0 +1,348 @@
+package bootcfg
+
+import (
+	"bytes"
+	"dhcp/models"
+	"fmt"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var object *models.Object
+
+// 内置的 pxelinux 配置模板
+const defaultPXELinuxTemplate = `DEFAULT install
+PROMPT 0
+TIMEOUT 0
+
+LABEL install
+  KERNEL {{.Kernel}}
+  APPEND initrd={{.Initrd}} {{.KernelArgs}}
+  IPAPPEND 2
+`
+
+// 内置的 grub 配置模板
+const defaultGrubTemplate = `set default=0
+set timeout=0
+
+menuentry 'Install {{.Profile}} on {{.Hostname}}' {
+  linux {{.Kernel}} {{.KernelArgs}}
+  initrd {{.Initrd}}
+}
+`
+
+// installed 状态的客户端使用的 pxelinux 配置, 从本地磁盘启动
+const localPXELinuxConfig = `DEFAULT local
+PROMPT 0
+TIMEOUT 0
+
+LABEL local
+  LOCALBOOT 0
+`
+
+// installed 状态的客户端使用的 grub 配置, 返回固件继续尝试下一个启动设备
+const localGrubConfig = `set default=0
+set timeout=0
+
+menuentry 'Boot from local disk' {
+  exit
+}
+`
+
+// 模板中可以使用的变量, 如: {{.MAC}}, {{.IP}}
+// IP 为绑定的地址, Hostname 为绑定的主机名(没有设置时使用租约中的主机名)
+// Arch 为租约中记录的客户端架构, 客户端没有发送架构类型时为 BIOS(Intel x86PC)
+// KernelArgs 为安装配置的 BootArgs(rescue 状态为 RescueArgs) 使用模板变量替换之后的结果, State 为绑定的安装状态
+type Vars struct {
+	MAC        string
+	IP         string
+	Hostname   string
+	Arch       string
+	Profile    string
+	Kernel     string
+	Initrd     string
+	KernelArgs string
+	State      string
+}
+
+// 生成的启动配置类型
+const (
+	kindPXELinux  = "pxelinux"
+	kindGrub      = "grub"
+	kindKickstart = "kickstart"
+)
+
+func Init(obj *models.Object) {
+	object = obj
+}
+
+// 根据文件名判断是否是需要生成的启动配置, 返回配置类型和客户端 mac 地址
+// pxelinux: pxelinux.cfg/01-aa-bb-cc-dd-ee-ff
+// grub: grub.cfg-01-aa-bb-cc-dd-ee-ff 或者 grub.cfg-aa:bb:cc:dd:ee:ff, 可以位于任意目录中
+// kickstart/preseed: kickstart/aa-bb-cc-dd-ee-ff 或者 kickstart/aa-bb-cc-dd-ee-ff.cfg
+func parseFilename(filename string) (string, string, bool) {
+	name := path.Clean("/" + strings.ReplaceAll(filename, "\\", "/"))
+	base := path.Base(name)
+
+	var kind, mac string
+	switch {
+	case path.Base(path.Dir(name)) == "pxelinux.cfg" && strings.HasPrefix(base, "01-"):
+		kind, mac = kindPXELinux, strings.TrimPrefix(base, "01-")
+	case path.Base(path.Dir(name)) == "kickstart":
+		kind, mac = kindKickstart, strings.TrimSuffix(base, ".cfg")
+	case strings.HasPrefix(base, "grub.cfg-"):
+		kind, mac = kindGrub, strings.TrimPrefix(strings.TrimPrefix(base, "grub.cfg-"), "01-")
+	default:
+		return "", "", false
+	}
+
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return "", "", false
+	}
+	return kind, hw.String(), true
+}
+
+// 查询引用了安装配置的绑定, mac 地址绑定优先, 只以 client identifier 绑定的客户端通过租约中的 client identifier 查询
+// 客户端没有引用安装配置的绑定时返回 nil
+func queryBinding(mac string, lease *models.Leases) (*models.Binding, error) {
+	var bind models.Binding
+	err := object.Db.Where("client_hw_addr = ? and profile <> ''", mac).First(&bind).Error
+	if err == gorm.ErrRecordNotFound && lease.ClientID != "" {
+		err = object.Db.Where("client_id = ? and profile <> ''", lease.ClientID).First(&bind).Error
+	}
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bind, nil
+}
+
+// 查询客户端的绑定和安装配置, 客户端没有绑定安装配置时返回 nil
+func queryVars(mac string) (*models.Binding, *models.Profile, *Vars, error) {
+	// 租约总是记录客户端的 mac 地址
+	var lease models.Leases
+	object.Db.Where("client_hw_addr = ?", mac).Order("expires desc").First(&lease)
+
+	bind, err := queryBinding(mac, &lease)
+	if err != nil || bind == nil {
+		return nil, nil, nil, err
+	}
+
+	var profile models.Profile
+	if err := object.Db.Where("name = ?", bind.Profile).First(&profile).Error; err != nil {
+		return nil, nil, nil, errors.New(fmt.Sprintf("profile %s does not exist", bind.Profile))
+	}
+
+	vars := &Vars{
+		MAC:      mac,
+		IP:       bind.BindAddr,
+		Hostname: bind.Hostname,
+		Arch:     leaseArch(&lease),
+		Profile:  profile.Name,
+		Kernel:   profile.Kernel,
+		Initrd:   profile.Initrd,
+		State:    bind.State,
+	}
+	if vars.Hostname == "" {
+		vars.Hostname = lease.Hostname
+	}
+
+	bootArgs := profile.BootArgs
+	if vars.State == models.BindStateRescue {
+		bootArgs = profile.RescueArgs
+		if bootArgs == "" {
+			bootArgs = profile.BootArgs + " rescue"
+		}
+	}
+	args, err := execute("boot_args", bootArgs, vars)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	vars.KernelArgs = strings.TrimSpace(args)
+	return bind, &profile, vars, nil
+}
+
+func execute(name, text string, vars *Vars) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// 生成客户端的启动配置, 文件名不是需要生成的启动配置或者客户端没有绑定安装配置时返回 false
+// 生成启动配置不修改安装状态, 客户端完整获取启动配置之后调用 Delivered
+func Render(filename string) ([]byte, bool) {
+	if object == nil {
+		return nil, false
+	}
+	kind, mac, ok := parseFilename(filename)
+	if !ok {
+		return nil, false
+	}
+	sign := log.Fields{"filename": filename, "mac": mac}
+
+	_, profile, vars, err := queryVars(mac)
+	if err != nil {
+		log.WithFields(sign).Errorf("Error render boot config %s", err.Error())
+		return nil, false
+	}
+	if profile == nil {
+		return nil, false
+	}
+	if !supportsArch(profile, vars.Arch) {
+		log.WithFields(sign).Warningf("Profile %s does not support client architecture %s", profile.Name, vars.Arch)
+		return nil, false
+	}
+
+	// 已经完成安装的客户端从本地磁盘启动
+	if vars.State == models.BindStateInstalled && kind != kindKickstart {
+		log.WithFields(sign).Debugf("Client installed, render local boot %s config", kind)
+		if kind == kindGrub {
+			return []byte(localGrubConfig), true
+		}
+		return []byte(localPXELinuxConfig), true
+	}
+
+	var text string
+	switch kind {
+	case kindPXELinux:
+		text = profile.PXELinuxTemplate
+		if text == "" {
+			text = defaultPXELinuxTemplate
+		}
+	case kindGrub:
+		text = profile.GrubTemplate
+		if text == "" {
+			text = defaultGrubTemplate
+		}
+	case kindKickstart:
+		// kickstart/preseed 没有通用的内置模板
+		if profile.KickstartTemplate == "" {
+			return nil, false
+		}
+		text = profile.KickstartTemplate
+	}
+
+	data, err := execute(kind, text, vars)
+	if err != nil {
+		log.WithFields(sign).Errorf("Error render boot config %s", err.Error())
+		return nil, false
+	}
+	log.WithFields(sign).Debugf("Render %s boot config with profile %s", kind, profile.Name)
+	return []byte(data), true
+}
+
+// 客户端已经完整获取(TFTP 传输完成或者 HTTP GET 成功)生成的启动配置, pending-install 状态的绑定开始安装
+// 只获取文件大小的 TFTP 请求和 HTTP HEAD 请求不应调用
+func Delivered(filename string) {
+	if object == nil {
+		return
+	}
+	kind, mac, ok := parseFilename(filename)
+	if !ok || kind == kindKickstart {
+		return
+	}
+	sign := log.Fields{"filename": filename, "mac": mac}
+
+	bind, _, vars, err := queryVars(mac)
+	if err != nil {
+		log.WithFields(sign).Errorf("Error query bind %s", err.Error())
+		return
+	}
+	if bind == nil || vars.State != models.BindStatePendingInstall {
+		return
+	}
+
+	err = object.Db.Model(&models.Binding{}).
+		Where("client_hw_addr = ? and client_id = ? and state = ?", bind.ClientHWAddr, bind.ClientID, models.BindStatePendingInstall).
+		Update("state", models.BindStateInstalling).Error
+	if err != nil {
+		log.WithFields(sign).Errorf("Error update bind state %s", err.Error())
+		return
+	}
+	log.WithFields(sign).Infof("Client fetched boot config, bind state %s", models.BindStateInstalling)
+}
+
+// 租约中记录的客户端架构, 没有发送架构类型的客户端为 BIOS 客户端
+func leaseArch(lease *models.Leases) string {
+	if lease.Arch == "" {
+		return iana.INTEL_X86PC.String()
+	}
+	return lease.Arch
+}
+
+// 解析安装配置支持的架构类型列表
+func parseArchitectures(s string) ([]iana.Arch, error) {
+	var archs []iana.Arch
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		arch, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid architecture %s", field))
+		}
+		archs = append(archs, iana.Arch(arch))
+	}
+	return archs, nil
+}
+
+func supportsArch(profile *models.Profile, name string) bool {
+	archs, err := parseArchitectures(profile.Architectures)
+	if err != nil {
+		return false
+	}
+	if len(archs) == 0 {
+		return true
+	}
+	for _, arch := range archs {
+		if arch.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 安装配置是否支持客户端的架构, 没有限制架构时支持所有架构
+func SupportsArch(profile *models.Profile, arch iana.Arch) bool {
+	return supportsArch(profile, arch.String())
+}
+
+// 检查安装配置的模板是否合法, 使用示例变量执行模板以发现引用了不存在的变量的错误
+func CheckProfile(profile *models.Profile) error {
+	if profile.Name == "" {
+		return errors.New("profile name is required")
+	}
+	if _, err := parseArchitectures(profile.Architectures); err != nil {
+		return err
+	}
+	vars := &Vars{MAC: "00:00:00:00:00:00", IP: "0.0.0.0"}
+	for name, text := range map[string]string{
+		"boot_args":          profile.BootArgs,
+		"rescue_args":        profile.RescueArgs,
+		"pxelinux_template":  profile.PXELinuxTemplate,
+		"grub_template":      profile.GrubTemplate,
+		"kickstart_template": profile.KickstartTemplate,
+	} {
+		if _, err := execute(name, text, vars); err != nil {
+			return errors.New(fmt.Sprintf("invalid %s %s", name, err.Error()))
+		}
+	}
+	return nil
+}
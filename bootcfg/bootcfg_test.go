@@ -0,0 +1,196 @@
+package bootcfg
+
+import (
+	"dhcp/models"
+	"dhcp/models/dbtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testMAC = "aa:bb:cc:dd:ee:ff"
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		kind     string
+		mac      string
+	}{
+		{"pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", kindPXELinux, testMAC},
+		{"/bios/pxelinux.cfg/01-AA-BB-CC-DD-EE-FF", kindPXELinux, testMAC},
+		{"pxelinux.cfg\\01-aa-bb-cc-dd-ee-ff", kindPXELinux, testMAC},
+		{"grub.cfg-01-aa-bb-cc-dd-ee-ff", kindGrub, testMAC},
+		{"/EFI/BOOT/grub.cfg-aa:bb:cc:dd:ee:ff", kindGrub, testMAC},
+		{"kickstart/aa-bb-cc-dd-ee-ff", kindKickstart, testMAC},
+		{"kickstart/aa-bb-cc-dd-ee-ff.cfg", kindKickstart, testMAC},
+		{"pxelinux.cfg/default", "", ""},
+		{"pxelinux.cfg/C0A80101", "", ""},
+		{"pxelinux.cfg/01-aa-bb-cc-dd-ee", "", ""},
+		{"grub.cfg", "", ""},
+		{"pxelinux.0", "", ""},
+	}
+	for _, test := range tests {
+		kind, mac, ok := parseFilename(test.filename)
+		if ok != (test.kind != "") || kind != test.kind || mac != test.mac {
+			t.Errorf("parseFilename(%q) = %q, %q, %v, want %q, %q", test.filename, kind, mac, ok, test.kind, test.mac)
+		}
+	}
+}
+
+// 使用内存中的表作为数据库
+func openTestDB(t *testing.T, tables dbtest.Tables) *dbtest.DB {
+	obj, db := dbtest.Open(tables.Handler())
+	Init(obj)
+	t.Cleanup(func() { Init(nil) })
+	return db
+}
+
+func TestRender(t *testing.T) {
+	profile := models.Profile{
+		Name:              "centos",
+		Kernel:            "vmlinuz",
+		Initrd:            "initrd.img",
+		BootArgs:          "ks=http://10.1.1.1:8888/boot/kickstart/{{.MAC}}",
+		KickstartTemplate: "network --hostname={{.Hostname}} --ip={{.IP}}",
+	}
+	rescueProfile := profile
+	rescueProfile.RescueArgs = "inst.rescue"
+	biosProfile := profile
+	biosProfile.Architectures = "0"
+
+	bind := models.Binding{ClientHWAddr: testMAC, BindAddr: "10.1.1.20", Hostname: "web01", Profile: "centos", State: models.BindStatePendingInstall}
+	noHostnameBind := bind
+	noHostnameBind.Hostname = ""
+	installedBind := bind
+	installedBind.State = models.BindStateInstalled
+	rescueBind := bind
+	rescueBind.State = models.BindStateRescue
+	lease := models.Leases{ClientHWAddr: testMAC, AssignedAddr: "10.1.1.20", Hostname: "lease-host", Arch: "EFI x86-64", Expires: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		name     string
+		filename string
+		tables   dbtest.Tables
+		// 生成的配置中应该包含的内容, 为空时表示不生成
+		want []string
+	}{
+		{
+			name:     "pxelinux",
+			filename: "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {bind}, "profiles": {profile}},
+			want:     []string{"KERNEL vmlinuz", "APPEND initrd=initrd.img ks=http://10.1.1.1:8888/boot/kickstart/aa:bb:cc:dd:ee:ff"},
+		},
+		{
+			name:     "grub",
+			filename: "grub.cfg-01-aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {bind}, "profiles": {profile}, "leases": {lease}},
+			want:     []string{"menuentry 'Install centos on web01'", "linux vmlinuz ks=", "initrd initrd.img"},
+		},
+		{
+			name:     "kickstart uses lease hostname",
+			filename: "kickstart/aa-bb-cc-dd-ee-ff.cfg",
+			tables:   dbtest.Tables{"bindings": {noHostnameBind}, "profiles": {profile}, "leases": {lease}},
+			want:     []string{"network --hostname=lease-host --ip=10.1.1.20"},
+		},
+		{
+			name:     "installed client boots from local disk",
+			filename: "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {installedBind}, "profiles": {profile}},
+			want:     []string{"LOCALBOOT 0"},
+		},
+		{
+			name:     "installed grub client exits to firmware",
+			filename: "grub.cfg-01-aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {installedBind}, "profiles": {profile}},
+			want:     []string{"exit"},
+		},
+		{
+			name:     "rescue with rescue args",
+			filename: "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {rescueBind}, "profiles": {rescueProfile}},
+			want:     []string{"APPEND initrd=initrd.img inst.rescue"},
+		},
+		{
+			name:     "rescue without rescue args",
+			filename: "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {rescueBind}, "profiles": {profile}},
+			want:     []string{"kickstart/aa:bb:cc:dd:ee:ff rescue"},
+		},
+		{
+			name:     "profile without client architecture",
+			filename: "grub.cfg-01-aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {bind}, "profiles": {biosProfile}, "leases": {lease}},
+		},
+		{
+			name:     "kickstart without template",
+			filename: "kickstart/aa-bb-cc-dd-ee-ff",
+			tables:   dbtest.Tables{"bindings": {bind}, "profiles": {biosProfile}},
+			want:     []string{"network"},
+		},
+		{
+			name:     "client without binding",
+			filename: "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff",
+		},
+		{
+			name:     "not a generated config",
+			filename: "pxelinux.cfg/default",
+			tables:   dbtest.Tables{"bindings": {bind}, "profiles": {profile}},
+		},
+	}
+	for _, test := range tests {
+		db := openTestDB(t, test.tables)
+		data, ok := Render(test.filename)
+		if ok != (len(test.want) > 0) {
+			t.Errorf("%s: Render() ok = %v\n%s", test.name, ok, data)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s: Render() = %q, want it to contain %q", test.name, data, want)
+			}
+		}
+		// 生成启动配置不修改安装状态
+		if execs := db.Execs(); len(execs) != 0 {
+			t.Errorf("%s: Render() executed %s", test.name, execs[0].SQL)
+		}
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	profile := models.Profile{Name: "centos", Kernel: "vmlinuz"}
+	bind := models.Binding{ClientHWAddr: testMAC, BindAddr: "10.1.1.20", Profile: "centos", State: models.BindStatePendingInstall}
+	installing := bind
+	installing.State = models.BindStateInstalling
+	installed := bind
+	installed.State = models.BindStateInstalled
+
+	tests := []struct {
+		name       string
+		filename   string
+		bind       models.Binding
+		installing bool
+	}{
+		{"pending install fetched pxelinux config", "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", bind, true},
+		{"pending install fetched grub config", "grub.cfg-01-aa-bb-cc-dd-ee-ff", bind, true},
+		// kickstart 由安装程序获取, 不表示开始安装
+		{"kickstart", "kickstart/aa-bb-cc-dd-ee-ff", bind, false},
+		{"already installing", "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", installing, false},
+		{"installed", "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", installed, false},
+	}
+	for _, test := range tests {
+		db := openTestDB(t, dbtest.Tables{"bindings": {test.bind}, "profiles": {profile}})
+		Delivered(test.filename)
+
+		updates := db.ExecsOn("UPDATE", "bindings")
+		if !test.installing {
+			if len(updates) != 0 {
+				t.Errorf("%s: unexpected update %s", test.name, updates[0].SQL)
+			}
+			continue
+		}
+		// 只更新仍然处于 pending-install 状态的绑定
+		if len(updates) != 1 || updates[0].Arg(0) != models.BindStateInstalling || !updates[0].Has("state = ?") {
+			t.Errorf("%s: updates %v, want state set to installing", test.name, updates)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"dhcp/api"
+	"dhcp/bootcfg"
 	"dhcp/models"
 	"dhcp/server"
+	"dhcp/tftp"
 	"flag"
 	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
@@ -12,13 +14,16 @@ import (
 )
 
 var (
-	d         *server.DHCPDConfig
-	enableApi bool
-	apiListen string
+	d            *server.DHCPDConfig
+	t            *tftp.TFTPDConfig
+	enableApi    bool
+	apiListen    string
+	httpBootRoot string
 )
 
 func init() {
 	d = &server.DHCPDConfig{}
+	t = &tftp.TFTPDConfig{}
 
 	flag.BoolVar(&enableApi, "enable-api", true, "打开 api 接口")
 	flag.StringVar(&apiListen, "api-listen", "0.0.0.0:8888", "api 接口监听地址")
@@ -26,6 +31,12 @@ func init() {
 	flag.StringVar(&d.Listen, "dhcpd-listen", "0.0.0.0", "dhcpd 监听地址")
 	flag.IntVar(&d.Port, "dhcpd-port", 67, "dhcpd 监听端口")
 	flag.StringVar(&d.IFName, "dhcpd-ifname", "", "dhcpd 监听接口")
+	flag.StringVar(&t.Root, "tftp-root", "", "tftp 根目录, 设置时启动内置的只读 tftp 服务器")
+	flag.StringVar(&t.Listen, "tftp-listen", "0.0.0.0:69", "tftp 监听地址")
+	flag.IntVar(&t.MaxTransfers, "tftp-max-transfers", 64, "tftp 同时进行的最大传输数量")
+	flag.StringVar(&httpBootRoot, "http-boot-root", "", "http 启动文件根目录, 设置时通过 api 接口的 /boot/ 路径提供启动文件")
+	flag.StringVar(&d.Mode, "mode", server.ModeDHCP, "运行模式, dhcp: 分配地址, proxy: ProxyDHCP 模式, 只为 PXE 客户端提供启动信息(同时监听 4011 端口)")
+	flag.BoolVar(&d.RawUnicast, "dhcpd-raw-unicast", false, "通过原始套接字将响应单播给还没有地址的客户端(不设置时广播)")
 	flag.BoolVar(&d.Debug, "debug", false, "是否打开调试日志")
 
 	// init db
@@ -53,17 +64,13 @@ func setLogLevel() logger.LogLevel {
 	return dbLogLevel
 }
 
-// 每分钟检查一次租约表, 删除过期的租约信息
+// 每分钟检查一次租约表和冲突地址表, 删除过期的租约信息和冲突地址
 func DeleteExpiredLease(object *models.Object) {
 	c := cron.New()
 	_, err := c.AddFunc("* * * * *", func() {
-		options := server.QueryOptions()
-		leaseTime, err := time.ParseDuration(options.LeaseTime)
-		if err != nil {
-			log.Fatalf("Error delete expired lease lease generation time %s", err.Error())
-			return
-		}
-		object.Db.Unscoped().Where("unix_timestamp(expires) < ?", time.Now().Add(leaseTime).Unix()).Delete(&models.Leases{})
+		// 各个地址池的租约时间可能不同, 所以直接根据租约的到期时间删除
+		object.Db.Unscoped().Where("unix_timestamp(expires) < ?", time.Now().Unix()).Delete(&models.Leases{})
+		object.Db.Unscoped().Where("unix_timestamp(expires) < ?", time.Now().Unix()).Delete(&models.Conflicts{})
 	})
 	if err != nil {
 		log.Fatalf("Error init delete expired lease cron job %s", err.Error())
@@ -74,38 +81,57 @@ func DeleteExpiredLease(object *models.Object) {
 // 设置 dhcp 服务器默认默认参数(仅在 Options 表为空的时候调用)
 func createDefaultConfig(object *models.Object) {
 	options := models.Options{
-		LeaseTime:    "1h",
-		ServerIP:     "10.1.1.1",
-		BootFileName: "pxelinux.0",
-		GatewayIP:    "10.1.1.1",
-		RangeStartIP: "10.1.1.10",
-		RangeEndIP:   "10.1.1.100",
-		NetMask:      "255.0.0.0",
-		Router:       "10.1.1.1",
-		DNS:          "223.5.5.5,223.6.6.6",
-		ACL:          false,
-		ACLAction:    "",
+		LeaseTime:       "1h",
+		ServerIP:        "10.1.1.1",
+		BootFileName:    "pxelinux.0",
+		GatewayIP:       "10.1.1.1",
+		RangeStartIP:    "10.1.1.10",
+		RangeEndIP:      "10.1.1.100",
+		NetMask:         "255.0.0.0",
+		Router:          "10.1.1.1",
+		DNS:             "223.5.5.5,223.6.6.6",
+		ACL:             false,
+		ACLAction:       "",
+		OfferHoldTime:   "30s",
+		DeclineHoldTime: "1h",
+		PingCheck:       false,
+		PingTimeout:     "500ms",
+		ClientKey:       models.ClientKeyClientID,
 	}
 	object.Db.FirstOrCreate(&options)
 }
 
 func main() {
+	if d.Mode != server.ModeDHCP && d.Mode != server.ModeProxy {
+		log.Fatalf("unknown mode %s, mode in (dhcp|proxy)", d.Mode)
+	}
+
 	logLevel := setLogLevel()
 	connMaxLifetime := time.Second * time.Duration(d.DBPoolConnMaxLifetime)
 
 	object := models.MustConnectDB(d.DBUser, d.DBHost, d.DBPass, d.DBName, d.DBPort, logLevel, d.DBPoolMaxIdleConns, d.DBPoolMaxOpenConns, connMaxLifetime)
 
-	if err := object.Db.AutoMigrate(&models.Leases{}, &models.Options{}, &models.ACL{}, &models.Binding{}, &models.Reserves{}); err != nil {
+	if err := models.MigrateClientID(object.Db); err != nil {
+		panic(err)
+	}
+
+	if err := object.Db.AutoMigrate(&models.Leases{}, &models.Options{}, &models.Subnet{}, &models.ACL{}, &models.Binding{}, &models.RelayBinding{}, &models.Reserves{}, &models.Conflicts{}, &models.CustomOption{}, &models.ClientClass{}, &models.ArchBoot{}, &models.PXEMenuItem{}, &models.Profile{}); err != nil {
 		panic(err)
 	}
 
 	createDefaultConfig(object)
 
+	bootcfg.Init(object)
+
 	go DeleteExpiredLease(object)
 
+	if t.Root != "" {
+		go tftp.TFTPD(t)
+	}
+
 	go func() {
 		if enableApi {
-			api.API(apiListen, d, logLevel, connMaxLifetime)
+			api.API(apiListen, httpBootRoot, d, logLevel, connMaxLifetime)
 		}
 	}()
 
@@ -0,0 +1,234 @@
+// 测试使用的数据库, 不需要连接 MySQL
+// 查询语句的结果由测试提供的函数返回, 其他语句(INSERT, UPDATE, DELETE)只被记录下来供测试检查
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"dhcp/models"
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const driverName = "dbtest"
+
+// 执行的 SQL 语句和参数
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
+// 语句是否访问了指定的表
+func (q *Query) Table(name string) bool {
+	return strings.Contains(q.SQL, "`"+name+"`")
+}
+
+// 语句是否包含指定的内容, 如: client_id = ?
+func (q *Query) Has(s string) bool {
+	return strings.Contains(q.SQL, s)
+}
+
+// 语句的第 i 个参数, 转换为字符串以便比较
+func (q *Query) Arg(i int) string {
+	if i >= len(q.Args) {
+		return ""
+	}
+	return fmt.Sprint(q.Args[i])
+}
+
+// 查询语句的行数(SELECT count(*))
+type Count int64
+
+// 返回查询语句的结果, 每一项为模型的结构体(如 models.Leases{}) 或者 Count, 返回 nil 表示没有结果
+type Handler func(q *Query) []interface{}
+
+type DB struct {
+	handler Handler
+
+	mu    sync.Mutex
+	execs []*Query
+}
+
+var (
+	registerOnce sync.Once
+	databases    sync.Map
+	schemas      sync.Map
+	nextID       int
+	nextIDLock   sync.Mutex
+)
+
+// 打开测试数据库, handler 为 nil 时所有查询都没有结果
+func Open(handler Handler) (*models.Object, *DB) {
+	registerOnce.Do(func() {
+		sql.Register(driverName, &fakeDriver{})
+	})
+	if handler == nil {
+		handler = func(*Query) []interface{} { return nil }
+	}
+
+	nextIDLock.Lock()
+	nextID++
+	dsn := fmt.Sprintf("db%d", nextID)
+	nextIDLock.Unlock()
+
+	db := &DB{handler: handler}
+	databases.Store(dsn, db)
+
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{
+		DriverName:                driverName,
+		DSN:                       dsn,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent), SkipDefaultTransaction: true})
+	if err != nil {
+		panic(err)
+	}
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		panic(err)
+	}
+	return &models.Object{Db: gormDB, Sqlx: sqlDB}, db
+}
+
+// 已经执行的 INSERT, UPDATE 和 DELETE 语句
+func (db *DB) Execs() []*Query {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]*Query(nil), db.execs...)
+}
+
+// 已经执行的以 prefix 开头(如 UPDATE, DELETE)并且访问了指定表的语句
+func (db *DB) ExecsOn(prefix, table string) []*Query {
+	var execs []*Query
+	for _, q := range db.Execs() {
+		if strings.HasPrefix(q.SQL, prefix) && q.Table(table) {
+			execs = append(execs, q)
+		}
+	}
+	return execs
+}
+
+// 清空已经记录的语句
+func (db *DB) Reset() {
+	db.mu.Lock()
+	db.execs = nil
+	db.mu.Unlock()
+}
+
+func (db *DB) exec(q *Query) {
+	db.mu.Lock()
+	db.execs = append(db.execs, q)
+	db.mu.Unlock()
+}
+
+func newQuery(query string, args []driver.NamedValue) *Query {
+	q := &Query{SQL: query}
+	for _, arg := range args {
+		q.Args = append(q.Args, arg.Value)
+	}
+	return q
+}
+
+// 将查询结果转换为数据库的行, 列名与 gorm 的默认命名相同
+func (db *DB) rows(q *Query) (*fakeRows, error) {
+	rows := &fakeRows{}
+	for _, value := range db.handler(q) {
+		if count, ok := value.(Count); ok {
+			rows.columns = []string{"count(*)"}
+			rows.values = append(rows.values, []driver.Value{int64(count)})
+			continue
+		}
+
+		s, err := schema.Parse(value, &schemas, schema.NamingStrategy{})
+		if err != nil {
+			return nil, err
+		}
+		reflectValue := reflect.Indirect(reflect.ValueOf(value))
+		var row []driver.Value
+		rows.columns = rows.columns[:0]
+		for _, name := range s.DBNames {
+			v, _ := s.FieldsByDBName[name].ValueOf(reflectValue)
+			dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				return nil, err
+			}
+			rows.columns = append(rows.columns, name)
+			row = append(row, dv)
+		}
+		rows.values = append(rows.values, row)
+	}
+	return rows, nil
+}
+
+type fakeDriver struct{}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	db, ok := databases.Load(dsn)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown test database %s", dsn))
+	}
+	return &fakeConn{db: db.(*DB)}, nil
+}
+
+type fakeConn struct {
+	db *DB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.rows(newQuery(query, args))
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.exec(newQuery(query, args))
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,344 @@
+package dbtest
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 内存中的表, 键为表名(如 leases), 值为模型的结构体
+// 查询时根据 WHERE 条件过滤, 并按照 ORDER BY 和 LIMIT 返回结果, 写入语句不修改表中的数据
+// 只支持测试用到的条件: col = ?, col = 'value', col <> ?, col in (?,...), unix_timestamp(col) > ?, unix_timestamp(col) < ?
+// 以及以 and, or 和括号组合的条件
+type Tables map[string][]interface{}
+
+// 返回按照表中的数据回答查询的 Handler
+func (t Tables) Handler() Handler {
+	return func(q *Query) []interface{} {
+		if !strings.HasPrefix(q.SQL, "SELECT") {
+			return nil
+		}
+		table := tableName(q.SQL)
+		result, err := t.query(table, q)
+		if err != nil {
+			panic(fmt.Sprintf("dbtest: %s: %s", q.SQL, err.Error()))
+		}
+		if strings.HasPrefix(q.SQL, "SELECT count(*)") {
+			return []interface{}{Count(len(result))}
+		}
+		return result
+	}
+}
+
+func tableName(query string) string {
+	i := strings.Index(query, " FROM `")
+	if i < 0 {
+		return ""
+	}
+	name := query[i+len(" FROM `"):]
+	return name[:strings.Index(name, "`")]
+}
+
+// 查询语句中的子句, 不存在时为空字符串
+func clause(query, name string, ends ...string) string {
+	i := strings.Index(query, " "+name+" ")
+	if i < 0 {
+		return ""
+	}
+	s := query[i+len(name)+2:]
+	for _, end := range ends {
+		if j := strings.Index(s, " "+end+" "); j >= 0 {
+			s = s[:j]
+		}
+	}
+	return s
+}
+
+func (t Tables) query(table string, q *Query) ([]interface{}, error) {
+	type row struct {
+		value  interface{}
+		fields map[string]driver.Value
+	}
+	var rows []row
+	for _, value := range t[table] {
+		fields, err := rowFields(value)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row{value: value, fields: fields})
+	}
+
+	if where := clause(q.SQL, "WHERE", "ORDER BY", "LIMIT"); where != "" {
+		var matched []row
+		for _, r := range rows {
+			p := &exprParser{tokens: tokenize(where), args: q.Args, fields: r.fields}
+			ok, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if p.pos != len(p.tokens) {
+				return nil, errors.New(fmt.Sprintf("unsupported condition %s", where))
+			}
+			if ok {
+				matched = append(matched, r)
+			}
+		}
+		rows = matched
+	}
+
+	if order := clause(q.SQL, "ORDER BY", "LIMIT"); order != "" {
+		keys := strings.Split(order, ",")
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, key := range keys {
+				fields := strings.Fields(key)
+				column := columnName(fields[0])
+				a, b := fmt.Sprint(rows[i].fields[column]), fmt.Sprint(rows[j].fields[column])
+				if a == b {
+					continue
+				}
+				if len(fields) > 1 && strings.EqualFold(fields[1], "desc") {
+					return a > b
+				}
+				return a < b
+			}
+			return false
+		})
+	}
+
+	if limit := clause(q.SQL+" ", "LIMIT"); limit != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(limit)); err == nil && n < len(rows) {
+			rows = rows[:n]
+		}
+	}
+
+	var result []interface{}
+	for _, r := range rows {
+		result = append(result, r.value)
+	}
+	return result, nil
+}
+
+// 去掉列名中的表名和反引号, 如: `leases`.`client_id`
+func columnName(s string) string {
+	if i := strings.LastIndex(s, "."); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.Trim(s, "`")
+}
+
+func rowFields(value interface{}) (map[string]driver.Value, error) {
+	s, err := schema.Parse(value, &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	reflectValue := reflect.Indirect(reflect.ValueOf(value))
+	fields := make(map[string]driver.Value)
+	for _, name := range s.DBNames {
+		v, _ := s.FieldsByDBName[name].ValueOf(reflectValue)
+		if fields[name], err = driver.DefaultParameterConverter.ConvertValue(v); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// 将条件拆分为标识符, 字符串, 操作符和括号
+func tokenize(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ':
+			i++
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				j = len(s) - i - 1
+			}
+			tokens = append(tokens, s[i:i+j+2])
+			i += j + 2
+		case strings.HasPrefix(s[i:], "<>") || strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, "<>")
+			i += 2
+		case strings.ContainsRune("()=<>?,", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || strings.ContainsRune("_`.", rune(s[j]))) {
+				j++
+			}
+			if j == i {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	args   []interface{}
+	argPos int
+	fields map[string]driver.Value
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *exprParser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+	if err != nil {
+		return false, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+	return result, nil
+}
+
+func (p *exprParser) parseAnd() (bool, error) {
+	result, err := p.parsePrimary()
+	if err != nil {
+		return false, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+	return result, nil
+}
+
+// 读取一个值: 参数(?) 或者字符串
+func (p *exprParser) value() (string, error) {
+	token := p.next()
+	switch {
+	case token == "?":
+		if p.argPos >= len(p.args) {
+			return "", errors.New("missing argument")
+		}
+		arg := p.args[p.argPos]
+		p.argPos++
+		if t, ok := arg.(time.Time); ok {
+			return strconv.FormatInt(t.Unix(), 10), nil
+		}
+		return fmt.Sprint(arg), nil
+	case strings.HasPrefix(token, "'"):
+		return strings.Trim(token, "'"), nil
+	default:
+		if _, err := strconv.ParseInt(token, 10, 64); err == nil {
+			return token, nil
+		}
+		return "", errors.New(fmt.Sprintf("unsupported value %s", token))
+	}
+}
+
+func (p *exprParser) parsePrimary() (bool, error) {
+	if p.peek() == "(" {
+		p.next()
+		result, err := p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if p.next() != ")" {
+			return false, errors.New("missing )")
+		}
+		return result, nil
+	}
+
+	column := p.next()
+	var field string
+	if strings.EqualFold(column, "unix_timestamp") {
+		if p.next() != "(" {
+			return false, errors.New("unsupported function")
+		}
+		name := columnName(p.next())
+		if p.next() != ")" {
+			return false, errors.New("unsupported function")
+		}
+		t, ok := p.fields[name].(time.Time)
+		if !ok {
+			return false, errors.New(fmt.Sprintf("column %s is not a time", name))
+		}
+		field = strconv.FormatInt(t.Unix(), 10)
+	} else {
+		value, ok := p.fields[columnName(column)]
+		if !ok {
+			return false, errors.New(fmt.Sprintf("unknown column %s", column))
+		}
+		field = fmt.Sprint(value)
+	}
+
+	op := p.next()
+	if strings.EqualFold(op, "in") {
+		if p.next() != "(" {
+			return false, errors.New("missing (")
+		}
+		result := false
+		for {
+			value, err := p.value()
+			if err != nil {
+				return false, err
+			}
+			result = result || field == value
+			token := p.next()
+			if token == ")" {
+				return result, nil
+			}
+			if token != "," {
+				return false, errors.New("unsupported in list")
+			}
+		}
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "=":
+		return field == value, nil
+	case "<>":
+		return field != value, nil
+	case ">", "<":
+		a, errA := strconv.ParseInt(field, 10, 64)
+		b, errB := strconv.ParseInt(value, 10, 64)
+		if errA != nil || errB != nil {
+			return false, errors.New(fmt.Sprintf("unsupported comparison %s %s %s", field, op, value))
+		}
+		if op == ">" {
+			return a > b, nil
+		}
+		return a < b, nil
+	}
+	return false, errors.New(fmt.Sprintf("unsupported operator %s", op))
+}
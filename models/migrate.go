@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// 旧版本的 leases, bindings, acls 表只使用 client_hw_addr 作为主键
+// 支持 client identifier 之后主键修改为 (client_hw_addr, client_id), AutoMigrate 不会修改主键, 所以需要在 AutoMigrate 之前手动修改
+func MigrateClientID(db *gorm.DB) error {
+	for _, model := range []interface{}{&Leases{}, &Binding{}, &ACL{}} {
+		if !db.Migrator().HasTable(model) || db.Migrator().HasColumn(model, "ClientID") {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+
+		sql := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `client_id` varchar(256) NOT NULL DEFAULT '', DROP PRIMARY KEY, ADD PRIMARY KEY (`client_hw_addr`, `client_id`)", stmt.Schema.Table)
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,12 +4,14 @@ import (
 	"time"
 )
 
-// 配置信息(在数据库中应该也必须只能有一条配置信息存在)
+// 全局配置信息(在数据库中应该也必须只能有一条配置信息存在)
+// 当没有配置任何地址池(Subnet)时, 使用此处的地址范围作为默认地址池
 type Options struct {
 	LeaseTime    string `gorm:"unique" json:"lease_time" form:"lease_time" binding:"required"`
 	ServerIP     string `gorm:"primarykey" json:"server_ip" form:"server_ip" binding:"required"`
 	BootFileName string `gorm:"unique" json:"boot_file_name" form:"boot_file_name" binding:"required"`
-	GatewayIP    string `gorm:"unique" json:"gateway_ip" form:"gateway_ip" binding:"required"`
+	// 已废弃, 响应中的 giaddr 由中继代理填写, 服务器只会原样返回
+	GatewayIP    string `gorm:"unique" json:"gateway_ip" form:"gateway_ip"`
 	RangeStartIP string `gorm:"unique" json:"range_start_ip" form:"range_start_ip" binding:"required"`
 	RangeEndIP   string `gorm:"unique" json:"range_end_ip" form:"range_end_ip" binding:"required"`
 	NetMask      string `gorm:"unique" json:"net_mask" form:"net_mask" binding:"required"`
@@ -20,28 +22,274 @@ type Options struct {
 	// 当 ACLAction 为  deny 时默认的动作为 allow, 只有被匹配到的客户端才会被拒绝
 	// allow or deny
 	ACLAction string `gorm:"unique" json:"acl_action" form:"acl_action"`
+	// 发送 DHCPOFFER 之后为客户端保留地址的时间, 客户端在此时间内没有发送 DHCPREQUEST 则地址被回收
+	OfferHoldTime string `gorm:"default:30s" json:"offer_hold_time" form:"offer_hold_time"`
+	// 冲突地址(被客户端拒绝或者分配前探测到已被使用)在此时间内不会被再次分配
+	DeclineHoldTime string `gorm:"default:1h" json:"decline_hold_time" form:"decline_hold_time"`
+	// 分配地址之前是否通过 ICMP echo 和 ARP(直连网段) 检查地址是否已被使用
+	PingCheck   bool   `json:"ping_check" form:"ping_check"`
+	PingTimeout string `gorm:"default:500ms" json:"ping_timeout" form:"ping_timeout"`
+	// 续约时间(T1)和重新绑定时间(T2), 留空时分别为租约时间的 50% 和 87.5%
+	RenewalTime   string `json:"renewal_time" form:"renewal_time"`
+	RebindingTime string `json:"rebinding_time" form:"rebinding_time"`
+	// 客户端请求的租约时间(option 51)被限制在此范围之内, 两者都留空时忽略客户端请求的租约时间
+	MinLeaseTime string `json:"min_lease_time" form:"min_lease_time"`
+	MaxLeaseTime string `json:"max_lease_time" form:"max_lease_time"`
+	// 识别客户端的方式
+	// client_id: 客户端发送了 client identifier(option 61) 时优先使用 client identifier, 否则使用硬件地址(chaddr)
+	// hw_addr: 只使用硬件地址
+	ClientKey string `gorm:"default:client_id" json:"client_key" form:"client_key"`
+	// 没有绑定主机名的客户端使用此模板生成主机名(option 12), 留空表示不为客户端分配主机名
+	// {mac} 替换为不带分隔符的 mac 地址, {ip} 替换为以 - 分隔的 IP 地址, 如: pxe-{mac}, node-{ip}
+	HostnamePattern string `json:"hostname_pattern" form:"hostname_pattern"`
+	// iPXE 客户端(option 77 为 iPXE 或者发送了 option 175)使用的启动脚本地址, 如: http://10.1.1.1/boot.ipxe
+	// 留空时 iPXE 客户端与其他客户端使用相同的启动文件
+	IPXEScriptURL string `json:"ipxe_script_url" form:"ipxe_script_url"`
+	// UEFI HTTP 启动客户端(option 60 为 HTTPClient)使用的启动文件地址, 如: http://10.1.1.1:8888/boot/shimx64.efi
+	// 以 / 结尾时作为目录, 根据客户端架构添加默认的启动文件(如: grubx64.efi)
+	HTTPBootURL string `json:"http_boot_url" form:"http_boot_url"`
+	NetworkOptions
+	PXEOptions
 }
 
+// PXE 客户端(option 60 为 PXEClient)使用的 option 43 子选项, 地址池中留空的配置项继承全局配置
+// 启动菜单的菜单项见 PXEMenuItem
+type PXEOptions struct {
+	// PXE_DISCOVERY_CONTROL(子选项 6), 0-255
+	// bit 0: 禁止广播发现启动服务器, bit 1: 禁止多播发现, bit 2: 只使用 PXE_BOOT_SERVERS 中的启动服务器
+	// bit 3: 已经提供启动文件时直接下载启动文件, 不显示启动菜单和提示
+	PXEDiscoveryControl string `json:"pxe_discovery_control" form:"pxe_discovery_control"`
+	// 启动菜单的提示信息(子选项 10)
+	PXEMenuPrompt string `json:"pxe_menu_prompt" form:"pxe_menu_prompt"`
+	// 启动菜单的超时时间(秒), 0 表示立即选择第一个菜单项, 255 表示一直等待用户选择
+	PXEMenuTimeout string `json:"pxe_menu_timeout" form:"pxe_menu_timeout"`
+}
+
+// 常用的网络配置选项, 地址池中留空的配置项继承全局配置
+type NetworkOptions struct {
+	// 域名(option 15)
+	DomainName string `json:"domain_name" form:"domain_name"`
+	// 域名搜索列表(option 119), 多个域名以逗号(,)分隔
+	DomainSearch string `json:"domain_search" form:"domain_search"`
+	// NTP 服务器(option 42), 多个地址以逗号(,)分隔
+	NTPServers string `json:"ntp_servers" form:"ntp_servers"`
+	// 广播地址(option 28), 留空时根据子网计算, 全局配置只对默认地址池有效
+	BroadcastAddr string `json:"broadcast_addr" form:"broadcast_addr"`
+	// 接口 MTU(option 26)
+	MTU string `json:"mtu" form:"mtu"`
+	// 无类别静态路由(option 121, 以及微软客户端使用的 option 249), 格式为 目的网络:网关, 多条路由以逗号(,)分隔
+	// 如: 10.0.0.0/8:10.1.1.1,0.0.0.0/0:10.1.1.254, 客户端收到此选项之后会忽略 option 3, 所以需要包含默认路由
+	ClasslessRoutes string `json:"classless_routes" form:"classless_routes"`
+}
+
+// 识别客户端的方式
+const (
+	ClientKeyClientID = "client_id"
+	ClientKeyHWAddr   = "hw_addr"
+)
+
+// 地址池(作用域), 每个地址池对应一个子网
+// 除 Name, CIDR, Ranges 以外留空的配置项继承 Options 中的全局配置
+type Subnet struct {
+	Name string `gorm:"primarykey" json:"name" form:"name" binding:"required"`
+	CIDR string `gorm:"unique" json:"cidr" form:"cidr" binding:"required"`
+	// 可分配的地址段, 多个地址段以逗号(,)分隔, 如: 10.1.1.10-10.1.1.100,10.1.1.150-10.1.1.200
+	Ranges       string `gorm:"not null" json:"ranges" form:"ranges" binding:"required"`
+	ServerIP     string `json:"server_ip" form:"server_ip"`
+	Router       string `json:"router" form:"router"`
+	DNS          string `json:"dns" form:"dns"`
+	LeaseTime    string `json:"lease_time" form:"lease_time"`
+	BootFileName string `json:"boot_file_name" form:"boot_file_name"`
+	// 续约时间(T1)和重新绑定时间(T2), 留空时分别为租约时间的 50% 和 87.5%
+	RenewalTime   string `json:"renewal_time" form:"renewal_time"`
+	RebindingTime string `json:"rebinding_time" form:"rebinding_time"`
+	// 客户端请求的租约时间(option 51)被限制在此范围之内, 两者都留空时忽略客户端请求的租约时间
+	MinLeaseTime string `json:"min_lease_time" form:"min_lease_time"`
+	MaxLeaseTime string `json:"max_lease_time" form:"max_lease_time"`
+	// 没有绑定主机名的客户端使用此模板生成主机名, 格式与 Options.HostnamePattern 相同
+	HostnamePattern string `json:"hostname_pattern" form:"hostname_pattern"`
+	// iPXE 客户端使用的启动脚本地址
+	IPXEScriptURL string `json:"ipxe_script_url" form:"ipxe_script_url"`
+	// UEFI HTTP 启动客户端使用的启动文件地址
+	HTTPBootURL string `json:"http_boot_url" form:"http_boot_url"`
+	NetworkOptions
+	PXEOptions
+}
+
+// 租约状态
+const (
+	// 已经发送 DHCPOFFER, 等待客户端确认
+	LeaseStateOffered = "offered"
+	// 已经发送 DHCPACK, 租约生效
+	LeaseStateBound = "bound"
+)
+
 // 租约信息
+// 以 client identifier 识别的客户端 ClientID 为 option 61 的十六进制字符串, 否则为空
+// Hostname 为客户端发送的主机名(option 12 或者 option 81 中的域名), Arch 为客户端发送的架构类型(option 93)
 type Leases struct {
 	ClientHWAddr string    `gorm:"primarykey" json:"client_hw_addr"`
+	ClientID     string    `gorm:"primarykey" json:"client_id"`
 	AssignedAddr string    `gorm:"unique" json:"assigned_addr"`
+	Subnet       string    `json:"subnet"`
+	CircuitID    string    `json:"circuit_id"`
+	RemoteID     string    `json:"remote_id"`
+	Hostname     string    `json:"hostname"`
+	ClientClass  string    `json:"client_class"`
+	Arch         string    `json:"arch"`
+	State        string    `gorm:"default:bound" json:"state"`
+	Expires      time.Time `gorm:"not null" json:"expires"`
+}
+
+// 冲突原因
+const (
+	// 客户端发送了 DHCPDECLINE(通过 ARP 发现地址已被使用)
+	ConflictReasonDecline = "decline"
+	// 分配地址之前通过 ICMP echo 或者 ARP 探测到地址已被使用
+	ConflictReasonPing = "ping"
+)
+
+// 冲突地址, 在到期之前不会被分配给任何客户端
+type Conflicts struct {
+	Address string `gorm:"primarykey" json:"address"`
+	Subnet  string `json:"subnet"`
+	// 报告冲突的客户端
+	ClientHWAddr string    `json:"client_hw_addr"`
+	Reason       string    `gorm:"not null" json:"reason"`
 	Expires      time.Time `gorm:"not null" json:"expires"`
 }
 
-// 允许或者拒绝的客户端
+// 允许或者拒绝的客户端, 通过 mac 地址或者 client identifier(十六进制字符串) 匹配, 两者只需要指定一项
 type ACL struct {
 	ClientHWAddr string `gorm:"primarykey" json:"client_hw_addr"`
+	ClientID     string `gorm:"primarykey" json:"client_id"`
 	Action       string `gorm:"not null" json:"action"`
 }
 
-// mac 地址绑定
+// mac 地址绑定, 也可以通过 client identifier(十六进制字符串) 绑定, 两者只需要指定一项
 type Binding struct {
 	ClientHWAddr string `gorm:"primarykey" json:"client_hw_addr"`
+	ClientID     string `gorm:"primarykey" json:"client_id"`
 	BindAddr     string `gorm:"unique" json:"bind_addr"`
+	// 分配给客户端的主机名(option 12), 留空时使用地址池的主机名模板
+	Hostname string `json:"hostname"`
+	// iPXE 启动脚本地址, 留空时使用地址池的配置
+	IPXEScriptURL string `json:"ipxe_script_url"`
+	// 安装配置名称, 设置时为客户端生成 pxelinux.cfg/01-<mac> 和 grub.cfg-01-<mac>
+	Profile string `json:"profile"`
+	// 安装状态, 添加绑定时留空为 pending-install, 修改绑定时留空表示保留原来的状态
+	State string `gorm:"not null;default:pending-install" json:"state"`
+}
+
+// 绑定的安装状态
+// 客户端获取生成的启动配置之后从 pending-install 进入 installing, 安装程序完成安装之后通过 /update/bindstate/ 设置为 installed
+// installed 状态的客户端从本地磁盘启动, 直到管理员通过 /update/bind/ 重新设置为 pending-install
+// rescue 状态的客户端使用安装配置的 RescueArgs 启动救援系统
+const (
+	BindStatePendingInstall = "pending-install"
+	BindStateInstalling     = "installing"
+	BindStateInstalled      = "installed"
+	BindStateRescue         = "rescue"
+)
+
+// 中继代理信息(option 82)绑定, 从指定交换机(remote-id)端口(circuit-id)接入的客户端总是分配到绑定的地址
+// RemoteID 留空表示匹配任意交换机, 不可打印的值以十六进制字符串表示
+type RelayBinding struct {
+	BindAddr  string `gorm:"primarykey" json:"bind_addr"`
+	CircuitID string `gorm:"uniqueIndex:idx_relay_agent;not null" json:"circuit_id"`
+	RemoteID  string `gorm:"uniqueIndex:idx_relay_agent" json:"remote_id"`
 }
 
 // 地址保留
 type Reserves struct {
 	Address string `gorm:"primarykey" json:"address"`
 }
+
+// 自定义选项的作用范围
+const (
+	// 所有客户端
+	OptionScopeGlobal = "global"
+	// 指定地址池中的客户端, Target 为地址池名称
+	OptionScopeSubnet = "subnet"
+	// 指定客户端, Target 为 mac 地址或者 client identifier(十六进制字符串)
+	OptionScopeBinding = "binding"
+	// 匹配客户端分类的客户端, Target 为客户端分类名称
+	OptionScopeClass = "class"
+)
+
+// 自定义选项的值类型
+const (
+	OptionTypeIP     = "ip"
+	OptionTypeIPList = "ip-list"
+	OptionTypeString = "string"
+	OptionTypeUint8  = "uint8"
+	OptionTypeUint16 = "uint16"
+	OptionTypeUint32 = "uint32"
+	OptionTypeBool   = "bool"
+	OptionTypeHex    = "hex"
+)
+
+// 自定义 DHCP 选项, 客户端发送了参数请求列表(option 55)时只发送列表中包含的选项
+// 同一个选项同时存在多个作用范围时优先级为 binding > class > subnet > global
+// ip-list 类型的多个地址以逗号(,)分隔, hex 类型为十六进制字符串
+type CustomOption struct {
+	Scope  string `gorm:"primarykey" json:"scope" binding:"required"`
+	Target string `gorm:"primarykey" json:"target"`
+	Code   uint8  `gorm:"primarykey;autoIncrement:false" json:"code" binding:"required"`
+	Type   string `gorm:"not null" json:"type" binding:"required"`
+	Value  string `gorm:"not null" json:"value"`
+}
+
+// 客户端分类, 根据匹配表达式对客户端分类, 客户端只属于按 Priority 从小到大第一个匹配的分类
+// 表达式的语法见 server/expr.go, 如: vendor_class prefix "PXEClient" and oui == "00:50:56"
+type ClientClass struct {
+	Name     string `gorm:"primarykey" json:"name" binding:"required"`
+	Match    string `gorm:"not null" json:"match" binding:"required"`
+	Priority int    `json:"priority"`
+	// 匹配的客户端从这些地址段中分配地址, 格式与 Subnet.Ranges 相同, 不在客户端所在地址池子网中的地址段被忽略
+	Ranges string `json:"ranges"`
+	// 匹配的客户端使用的启动文件, 留空时使用地址池的配置
+	BootFileName string `json:"boot_file_name"`
+	// 开启 ACL 时, 与 ACLAction 相同的动作对所有匹配的客户端生效(allow or deny), 留空表示不参与 ACL
+	Action string `json:"action"`
+}
+
+// 根据客户端架构类型(option 93)选择启动文件和 next-server, Subnet 留空表示适用于所有地址池
+// 地址池的配置优先于全局配置, NextServer 留空时使用地址池的 ServerIP
+type ArchBoot struct {
+	Subnet       string `gorm:"primarykey" json:"subnet"`
+	Arch         uint16 `gorm:"primarykey;autoIncrement:false" json:"arch"`
+	BootFileName string `gorm:"not null" json:"boot_file_name" binding:"required"`
+	NextServer   string `json:"next_server"`
+}
+
+// PXE 启动菜单项, Subnet 留空表示适用于所有地址池, 地址池配置了菜单项时不使用全局的菜单项
+// Type 为启动服务器类型, 0 表示从本地磁盘启动, 选择其他菜单项时客户端向启动服务器请求 BootFileName
+// Server 为启动服务器地址, 留空时使用地址池的 ServerIP
+type PXEMenuItem struct {
+	Subnet       string `gorm:"primarykey" json:"subnet"`
+	Type         uint16 `gorm:"primarykey;autoIncrement:false" json:"type"`
+	Description  string `gorm:"not null" json:"description" binding:"required"`
+	BootFileName string `json:"boot_file_name"`
+	Server       string `json:"server"`
+}
+
+// 安装配置, 绑定引用安装配置后根据模板为客户端生成 pxelinux 和 grub 的启动配置以及 kickstart/preseed 文件
+// 模板使用 Go 模板语法(text/template), 留空时使用内置的模板, 可用的变量见 bootcfg/bootcfg.go
+// BootArgs 也可以使用模板变量, 如: ks=http://10.1.1.1:8888/boot/kickstart/{{.MAC}}
+// RescueArgs 为 rescue 状态使用的启动参数, 留空时在 BootArgs 之后添加 rescue
+// BootFileName 和 EFIBootFileName 分别为 BIOS 和 UEFI 客户端的启动文件, 留空时按照地址池和架构的配置选择
+// Architectures 为支持的客户端架构类型(option 93)列表, 以逗号分隔, 如: 0,7,9, 留空表示支持所有架构
+type Profile struct {
+	Name              string `gorm:"primarykey" json:"name" binding:"required"`
+	Kernel            string `json:"kernel"`
+	Initrd            string `json:"initrd"`
+	BootArgs          string `json:"boot_args"`
+	RescueArgs        string `json:"rescue_args"`
+	BootFileName      string `json:"boot_file_name"`
+	EFIBootFileName   string `json:"efi_boot_file_name"`
+	Architectures     string `json:"architectures"`
+	PXELinuxTemplate  string `gorm:"type:text" json:"pxelinux_template"`
+	GrubTemplate      string `gorm:"type:text" json:"grub_template"`
+	KickstartTemplate string `gorm:"type:text" json:"kickstart_template"`
+}
@@ -0,0 +1,73 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+	"net"
+	"time"
+)
+
+func htons(i uint16) uint16 {
+	return (i<<8)&0xff00 | i>>8
+}
+
+// 发送 ARP 探测(RFC 5227, 发送方地址为 0.0.0.0), 收到目标地址的应答表示地址已被使用
+func arpProbe(iface *net.Interface, ip net.IP, timeout time.Duration) (bool, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, int(htons(unix.ETH_P_ARP)))
+	if err != nil {
+		return false, err
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ARP), Ifindex: iface.Index}); err != nil {
+		return false, err
+	}
+
+	// ARP 请求: 硬件类型, 协议类型, 硬件地址长度, 协议地址长度, 操作码, 发送方 MAC, 发送方 IP, 目标 MAC, 目标 IP
+	packet := new(bytes.Buffer)
+	_ = binary.Write(packet, binary.BigEndian, []uint16{1, unix.ETH_P_IP})
+	packet.Write([]byte{6, 4})
+	_ = binary.Write(packet, binary.BigEndian, uint16(1))
+	packet.Write(iface.HardwareAddr)
+	packet.Write(net.IPv4zero.To4())
+	packet.Write(make([]byte, 6))
+	packet.Write(ip.To4())
+
+	to := &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ARP), Ifindex: iface.Index, Halen: 6}
+	copy(to.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if err := unix.Sendto(fd, packet.Bytes(), 0, to); err != nil {
+		return false, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 128)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+		tv := unix.NsecToTimeval(remaining.Nanoseconds())
+		if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return false, err
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			return false, err
+		}
+		// 只关心 ARP 应答, 发送方 IP 位于第 14 到 18 字节
+		if n < 28 || binary.BigEndian.Uint16(buf[6:8]) != 2 {
+			continue
+		}
+		if net.IP(buf[14:18]).Equal(ip.To4()) {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// 非 linux 平台不支持 ARP 探测, 只使用 ICMP echo 检查地址
+func arpProbe(iface *net.Interface, ip net.IP, timeout time.Duration) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"dhcp/bootcfg"
+	"dhcp/models"
+	"fmt"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// iPXE 使用的封装选项(option 175), iPXE 发送的 DHCP 请求中总是包含此选项
+const optionIPXEEncapsulated = dhcpv4.GenericOptionCode(175)
+
+// 没有配置架构启动文件时 UEFI 客户端使用的默认启动文件
+// BIOS 客户端(Intel x86PC) 使用地址池的启动文件(默认为 pxelinux.0)
+// UEFI HTTP 启动客户端的启动文件添加在以 / 结尾的 HTTPBootURL 之后
+var defaultArchBootFiles = map[iana.Arch]string{
+	iana.EFI_IA32:        "grubia32.efi",
+	iana.EFI_X86_64:      "grubx64.efi",
+	iana.EFI_BC:          "grubx64.efi",
+	iana.EFI_ARM64:       "grubaa64.efi",
+	iana.EFI_X86_64_HTTP: "grubx64.efi",
+	iana.EFI_ARM64_HTTP:  "grubaa64.efi",
+}
+
+// 客户端是否是 iPXE, iPXE 发送的 user class(option 77) 为 iPXE, 并且会发送 option 175
+func isIPXE(req *dhcpv4.DHCPv4) bool {
+	if req.Options.Has(optionIPXEEncapsulated) {
+		return true
+	}
+	for _, userClass := range req.UserClass() {
+		if userClass == "iPXE" {
+			return true
+		}
+	}
+	return false
+}
+
+// 客户端的架构类型(option 93), 客户端没有发送时返回 false
+func clientArch(req *dhcpv4.DHCPv4) (iana.Arch, bool) {
+	archs := req.ClientArch()
+	if len(archs) == 0 {
+		return 0, false
+	}
+	return archs[0], true
+}
+
+// 查询客户端架构对应的启动配置, 地址池的配置优先于全局配置
+func (h *Handler) queryArchBoot(arch iana.Arch) (*models.ArchBoot, error) {
+	var archBoot models.ArchBoot
+	err := object.Db.Where("arch = ? and subnet in ?", uint16(arch), []string{h.subnet.Name, ""}).
+		Order("subnet desc").First(&archBoot).Error
+	if err != nil {
+		return nil, err
+	}
+	return &archBoot, nil
+}
+
+// 选择客户端使用的启动文件和 next-server(siaddr)
+// UEFI HTTP 启动客户端只能使用 URL, 见 httpBootURL
+// 已经完成安装(installed)的客户端从本地磁盘启动: 引用了安装配置的 PXE 客户端仍然加载启动文件, 生成的启动配置为本地启动
+// 其他客户端(iPXE, UEFI HTTP 启动以及没有引用安装配置的绑定)不返回启动文件
+// 1. iPXE 客户端使用 iPXE 启动脚本地址(绑定的配置优先于地址池), 避免 iPXE 再次加载自身导致循环
+// 2. 绑定引用的安装配置中客户端架构对应的启动文件
+// 3. 客户端分类的启动文件
+// 4. 客户端架构(option 93)对应的启动文件
+// 5. UEFI 客户端使用默认的启动文件
+// 6. 地址池的启动文件
+func (h *Handler) bootConfig() (string, net.IP) {
+	nextServer := net.ParseIP(h.subnet.ServerIP)
+
+	bind, err := h.queryBinding()
+	if err != nil {
+		bind = nil
+	}
+
+	if bind != nil && bind.State == models.BindStateInstalled {
+		h.sign["bind_state"] = bind.State
+		if bind.Profile == "" || isIPXE(h.req) || isHTTPClient(h.req) {
+			log.WithFields(h.sign).Debug("Client installed, boot from local disk without boot file")
+			return "", nextServer
+		}
+	}
+
+	if isHTTPClient(h.req) {
+		return h.httpBootURL(bind), nextServer
+	}
+
+	if isIPXE(h.req) {
+		scriptURL := h.subnet.IPXEScriptURL
+		if bind != nil && bind.IPXEScriptURL != "" {
+			scriptURL = bind.IPXEScriptURL
+		}
+		if scriptURL != "" {
+			log.WithFields(h.sign).Debugf("iPXE client, boot script %s", scriptURL)
+			return scriptURL, nextServer
+		}
+	}
+
+	if bootFileName := h.profileBootFile(bind); bootFileName != "" {
+		return bootFileName, nextServer
+	}
+
+	if h.class != nil && h.class.BootFileName != "" {
+		return h.class.BootFileName, nextServer
+	}
+
+	if arch, ok := clientArch(h.req); ok {
+		if archBoot, err := h.queryArchBoot(arch); err == nil {
+			if archBoot.NextServer != "" {
+				nextServer = net.ParseIP(archBoot.NextServer)
+			}
+			return archBoot.BootFileName, nextServer
+		}
+		if bootFileName, ok := defaultArchBootFiles[arch]; ok {
+			return bootFileName, nextServer
+		}
+	}
+	return h.subnet.BootFileName, nextServer
+}
+
+// 是否是完整的启动文件 URL
+func isBootURL(s string) bool {
+	return s != "" && CheckBootURL(s) == nil
+}
+
+// UEFI HTTP 启动客户端使用的启动文件 URL, 没有配置 URL 时返回空字符串(不返回 TFTP 的文件名)
+// 1. 绑定引用的安装配置中的 URL
+// 2. 客户端架构对应的启动文件中的 URL
+// 3. 地址池的 HTTPBootURL, 以 / 结尾时添加架构对应的默认启动文件
+func (h *Handler) httpBootURL(bind *models.Binding) string {
+	if bootFileName := h.profileBootFile(bind); isBootURL(bootFileName) {
+		return bootFileName
+	}
+
+	arch, ok := clientArch(h.req)
+	if ok {
+		if archBoot, err := h.queryArchBoot(arch); err == nil && isBootURL(archBoot.BootFileName) {
+			return archBoot.BootFileName
+		}
+	}
+
+	bootURL := h.subnet.HTTPBootURL
+	if strings.HasSuffix(bootURL, "/") {
+		bootFileName, found := defaultArchBootFiles[arch]
+		if !ok || !found {
+			log.WithFields(h.sign).Debugf("No default http boot file for client architecture %s", arch)
+			return ""
+		}
+		bootURL += bootFileName
+	}
+	if bootURL == "" {
+		log.WithFields(h.sign).Debug("UEFI HTTP boot client without http boot url, no boot file")
+	}
+	return bootURL
+}
+
+// 绑定引用的安装配置中客户端架构对应的启动文件, 安装配置不支持客户端的架构时不使用安装配置
+func (h *Handler) profileBootFile(bind *models.Binding) string {
+	if bind == nil || bind.Profile == "" {
+		return ""
+	}
+	var profile models.Profile
+	if err := object.Db.Where("name = ?", bind.Profile).First(&profile).Error; err != nil {
+		log.WithFields(h.sign).Errorf("Error query profile %s %s", bind.Profile, err.Error())
+		return ""
+	}
+	h.sign["profile"] = profile.Name
+
+	// 没有发送架构类型的客户端为 BIOS 客户端
+	arch, ok := clientArch(h.req)
+	if !ok {
+		arch = iana.INTEL_X86PC
+	}
+	if !bootcfg.SupportsArch(&profile, arch) {
+		log.WithFields(h.sign).Warningf("Profile %s does not support client architecture %s", profile.Name, arch)
+		return ""
+	}
+	if arch == iana.INTEL_X86PC {
+		return profile.BootFileName
+	}
+	return profile.EFIBootFileName
+}
+
+// 检查架构启动配置是否合法
+func CheckArchBoot(archBoot *models.ArchBoot) error {
+	if archBoot.BootFileName == "" {
+		return errors.New("empty boot file name")
+	}
+	if archBoot.NextServer != "" && net.ParseIP(archBoot.NextServer).To4() == nil {
+		return errors.New("invalid next server address")
+	}
+	return nil
+}
+
+// 检查启动文件地址是否合法, 留空表示不使用
+func CheckBootURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return errors.New(fmt.Sprintf("invalid boot url %s", s))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"dhcp/models"
+	"dhcp/models/dbtest"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"net"
+	"testing"
+)
+
+func TestBootConfig(t *testing.T) {
+	pxe := dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007"))
+	httpClient := dhcpv4.WithOption(dhcpv4.OptClassIdentifier("HTTPClient:Arch:00016"))
+	ipxe := dhcpv4.WithOption(dhcpv4.OptUserClass("iPXE"))
+	arch := func(arch iana.Arch) dhcpv4.Modifier {
+		return dhcpv4.WithOption(dhcpv4.OptClientArch(arch))
+	}
+
+	bind := models.Binding{ClientHWAddr: testHWAddr.String(), BindAddr: "10.1.1.20", State: models.BindStatePendingInstall}
+	ipxeBind := bind
+	ipxeBind.IPXEScriptURL = "http://10.1.1.2/host.ipxe"
+	profileBind := bind
+	profileBind.Profile = "centos"
+	installedBind := profileBind
+	installedBind.State = models.BindStateInstalled
+	installedPlainBind := bind
+	installedPlainBind.State = models.BindStateInstalled
+
+	profile := models.Profile{Name: "centos", BootFileName: "lpxelinux.0", EFIBootFileName: "shimx64.efi"}
+	biosProfile := profile
+	biosProfile.Architectures = "0"
+	urlProfile := profile
+	urlProfile.EFIBootFileName = "http://10.1.1.2/centos/shimx64.efi"
+
+	globalArch := models.ArchBoot{Arch: uint16(iana.EFI_X86_64), BootFileName: "global.efi", NextServer: "10.1.1.5"}
+	subnetArch := models.ArchBoot{Subnet: "test", Arch: uint16(iana.EFI_X86_64), BootFileName: "subnet.efi"}
+	urlArch := models.ArchBoot{Arch: uint16(iana.EFI_X86_64_HTTP), BootFileName: "http://10.1.1.2/arch/bootx64.efi"}
+	class := &models.ClientClass{Name: "lab", BootFileName: "class.efi"}
+
+	tests := []struct {
+		name       string
+		modifiers  []dhcpv4.Modifier
+		tables     dbtest.Tables
+		class      *models.ClientClass
+		httpURL    string
+		bootFile   string
+		nextServer net.IP
+	}{
+		{
+			name:     "bios client uses subnet boot file",
+			bootFile: "pxelinux.0",
+		},
+		{
+			name:      "uefi client uses default boot file",
+			modifiers: []dhcpv4.Modifier{pxe, arch(iana.EFI_X86_64)},
+			bootFile:  "grubx64.efi",
+		},
+		{
+			name:       "global architecture boot file and next server",
+			modifiers:  []dhcpv4.Modifier{pxe, arch(iana.EFI_X86_64)},
+			tables:     dbtest.Tables{"arch_boots": {globalArch}},
+			bootFile:   "global.efi",
+			nextServer: net.IP{10, 1, 1, 5},
+		},
+		{
+			name:      "subnet architecture boot file before global",
+			modifiers: []dhcpv4.Modifier{pxe, arch(iana.EFI_X86_64)},
+			tables:    dbtest.Tables{"arch_boots": {globalArch, subnetArch}},
+			bootFile:  "subnet.efi",
+		},
+		{
+			name:      "client class before architecture",
+			modifiers: []dhcpv4.Modifier{pxe, arch(iana.EFI_X86_64)},
+			tables:    dbtest.Tables{"arch_boots": {globalArch}},
+			class:     class,
+			bootFile:  "class.efi",
+		},
+		{
+			name:     "bound script is only for ipxe",
+			tables:   dbtest.Tables{"bindings": {ipxeBind}},
+			bootFile: "pxelinux.0",
+		},
+		{
+			name:      "ipxe uses subnet script",
+			modifiers: []dhcpv4.Modifier{ipxe},
+			class:     class,
+			bootFile:  "http://10.1.1.1/boot.ipxe",
+		},
+		{
+			name:      "ipxe uses bound script",
+			modifiers: []dhcpv4.Modifier{ipxe},
+			tables:    dbtest.Tables{"bindings": {ipxeBind}},
+			bootFile:  "http://10.1.1.2/host.ipxe",
+		},
+		{
+			name:     "profile bios boot file before class",
+			tables:   dbtest.Tables{"bindings": {profileBind}, "profiles": {profile}},
+			class:    class,
+			bootFile: "lpxelinux.0",
+		},
+		{
+			name:      "profile uefi boot file before architecture",
+			modifiers: []dhcpv4.Modifier{pxe, arch(iana.EFI_X86_64)},
+			tables:    dbtest.Tables{"bindings": {profileBind}, "profiles": {profile}, "arch_boots": {subnetArch}},
+			bootFile:  "shimx64.efi",
+		},
+		{
+			name:      "profile without the client architecture is skipped",
+			modifiers: []dhcpv4.Modifier{pxe, arch(iana.EFI_X86_64)},
+			tables:    dbtest.Tables{"bindings": {profileBind}, "profiles": {biosProfile}},
+			bootFile:  "grubx64.efi",
+		},
+		{
+			// 生成的启动配置为本地启动
+			name:     "installed client with profile still loads boot file",
+			tables:   dbtest.Tables{"bindings": {installedBind}, "profiles": {profile}},
+			bootFile: "lpxelinux.0",
+		},
+		{
+			name:     "installed client without profile",
+			tables:   dbtest.Tables{"bindings": {installedPlainBind}},
+			bootFile: "",
+		},
+		{
+			name:      "installed ipxe client",
+			modifiers: []dhcpv4.Modifier{ipxe},
+			tables:    dbtest.Tables{"bindings": {installedBind}, "profiles": {profile}},
+			bootFile:  "",
+		},
+		{
+			name:      "http client uses subnet url with default boot file",
+			modifiers: []dhcpv4.Modifier{httpClient, arch(iana.EFI_X86_64_HTTP)},
+			httpURL:   "http://10.1.1.1/efi/",
+			bootFile:  "http://10.1.1.1/efi/grubx64.efi",
+		},
+		{
+			name:      "http client uses subnet url",
+			modifiers: []dhcpv4.Modifier{httpClient, arch(iana.EFI_X86_64_HTTP)},
+			httpURL:   "http://10.1.1.1/efi/shim.efi",
+			bootFile:  "http://10.1.1.1/efi/shim.efi",
+		},
+		{
+			name:      "http client uses architecture url",
+			modifiers: []dhcpv4.Modifier{httpClient, arch(iana.EFI_X86_64_HTTP)},
+			tables:    dbtest.Tables{"arch_boots": {urlArch}},
+			httpURL:   "http://10.1.1.1/efi/",
+			bootFile:  "http://10.1.1.2/arch/bootx64.efi",
+		},
+		{
+			name:      "http client uses profile url",
+			modifiers: []dhcpv4.Modifier{httpClient, arch(iana.EFI_X86_64_HTTP)},
+			tables:    dbtest.Tables{"bindings": {profileBind}, "profiles": {urlProfile}, "arch_boots": {urlArch}},
+			httpURL:   "http://10.1.1.1/efi/",
+			bootFile:  "http://10.1.1.2/centos/shimx64.efi",
+		},
+		{
+			// TFTP 的文件名不能作为 HTTP 启动的 URL
+			name:      "http client skips profile tftp file",
+			modifiers: []dhcpv4.Modifier{httpClient, arch(iana.EFI_X86_64_HTTP)},
+			tables:    dbtest.Tables{"bindings": {profileBind}, "profiles": {profile}},
+			httpURL:   "http://10.1.1.1/efi/",
+			bootFile:  "http://10.1.1.1/efi/grubx64.efi",
+		},
+		{
+			name:      "http client without url",
+			modifiers: []dhcpv4.Modifier{httpClient, arch(iana.EFI_X86_64_HTTP)},
+			class:     class,
+			bootFile:  "",
+		},
+		{
+			name:      "http client with unknown architecture",
+			modifiers: []dhcpv4.Modifier{httpClient, arch(iana.EFI_ARM32_HTTP)},
+			httpURL:   "http://10.1.1.1/efi/",
+			bootFile:  "",
+		},
+	}
+	for _, test := range tests {
+		openTestDB(t, test.tables)
+		h, _ := newTestHandler(dhcpv4.MessageTypeOffer, test.modifiers...)
+		h.subnet.BootFileName = "pxelinux.0"
+		h.subnet.IPXEScriptURL = "http://10.1.1.1/boot.ipxe"
+		h.subnet.HTTPBootURL = test.httpURL
+		h.class = test.class
+
+		bootFile, nextServer := h.bootConfig()
+		if bootFile != test.bootFile {
+			t.Errorf("%s: boot file %q, want %q", test.name, bootFile, test.bootFile)
+		}
+		want := test.nextServer
+		if want == nil {
+			want = net.IP{10, 1, 1, 1}
+		}
+		if !nextServer.Equal(want) {
+			t.Errorf("%s: next server %s, want %s", test.name, nextServer, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"dhcp/models"
+	"encoding/hex"
+	"fmt"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+// 提取客户端请求中可以在匹配表达式中使用的字段
+func classFieldsOf(req *dhcpv4.DHCPv4) map[string]string {
+	mac := req.ClientHWAddr.String()
+	fields := map[string]string{
+		"mac":          mac,
+		"vendor_class": req.ClassIdentifier(),
+		"user_class":   strings.Join(req.UserClass(), ","),
+		"hostname":     clientHostname(req),
+		"client_id":    hex.EncodeToString(req.Options.Get(dhcpv4.OptionClientIdentifier)),
+	}
+	if len(mac) >= 8 {
+		fields["oui"] = mac[:8]
+	}
+	if archs := req.ClientArch(); len(archs) > 0 {
+		fields["arch"] = strconv.Itoa(int(archs[0]))
+	}
+	if relay := parseRelayInfo(req); relay != nil {
+		fields["circuit_id"] = relay.circuitID
+		fields["remote_id"] = relay.remoteID
+	}
+	for code, value := range req.Options {
+		fields[fmt.Sprintf("option_%d", code)] = hex.EncodeToString(value)
+	}
+	return fields
+}
+
+// 返回客户端所属的分类, 没有匹配的分类时返回 nil
+func matchClientClass(req *dhcpv4.DHCPv4, sign log.Fields) *models.ClientClass {
+	var classes []models.ClientClass
+	if err := object.Db.Order("priority, name").Find(&classes).Error; err != nil {
+		log.WithFields(sign).Errorf("Error query client class %s", err.Error())
+		return nil
+	}
+	if len(classes) == 0 {
+		return nil
+	}
+
+	fields := classFieldsOf(req)
+	for i := range classes {
+		expr, err := parseClassExpr(classes[i].Match)
+		if err != nil {
+			log.WithFields(sign).Errorf("Error parsing client class %s %s", classes[i].Name, err.Error())
+			continue
+		}
+		if expr.eval(fields) {
+			return &classes[i]
+		}
+	}
+	return nil
+}
+
+// 检查客户端分类是否合法
+func CheckClientClass(class *models.ClientClass) error {
+	if _, err := parseClassExpr(class.Match); err != nil {
+		return err
+	}
+	if class.Ranges != "" {
+		if _, err := parseRanges(class.Ranges); err != nil {
+			return err
+		}
+	}
+	if class.Action != "" && class.Action != "allow" && class.Action != "deny" {
+		return errors.New("action in (allow|deny) or empty")
+	}
+	return nil
+}
+
+// 客户端可以分配的地址段, 客户端分类的地址段中在当前地址池子网内的部分优先于地址池的地址段
+func (h *Handler) poolRanges() ([]ipRange, error) {
+	if h.class != nil && h.class.Ranges != "" {
+		network, err := parseCIDR(h.subnet.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		ranges, err := parseRanges(h.class.Ranges)
+		if err != nil {
+			return nil, err
+		}
+		var inSubnet []ipRange
+		for _, r := range ranges {
+			if network.Contains(uint32ToIP(r.start)) && network.Contains(uint32ToIP(r.end)) {
+				inSubnet = append(inSubnet, r)
+			}
+		}
+		if len(inSubnet) > 0 {
+			return inSubnet, nil
+		}
+	}
+	return parseRanges(h.subnet.Ranges)
+}
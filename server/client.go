@@ -0,0 +1,65 @@
+package server
+
+import (
+	"dhcp/models"
+	"encoding/hex"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 返回客户端的 client identifier(option 61) 的十六进制字符串
+// 客户端没有发送 option 61 或者配置为只使用硬件地址识别客户端时返回空字符串
+func clientIdentifier(req *dhcpv4.DHCPv4, options *models.Options) string {
+	if options.ClientKey == models.ClientKeyHWAddr {
+		return ""
+	}
+	return hex.EncodeToString(req.Options.Get(dhcpv4.OptionClientIdentifier))
+}
+
+// 查询当前客户端的记录
+// 使用 client identifier 识别的客户端只匹配 client_id, 否则匹配 client_hw_addr 且 client_id 为空
+func (h *Handler) whereClient(db *gorm.DB) *gorm.DB {
+	if h.clientID != "" {
+		return db.Where("client_id = ?", h.clientID)
+	}
+	return db.Where("client_hw_addr = ? and client_id = ''", h.msg.ClientHWAddr.String())
+}
+
+// 查询客户端的地址绑定, client identifier 绑定优先于 mac 地址绑定
+func (h *Handler) queryBinding() (*models.Binding, error) {
+	var bind models.Binding
+	if h.clientID != "" {
+		if err := object.Db.Where("client_id = ?", h.clientID).First(&bind).Error; err == nil {
+			return &bind, nil
+		}
+	}
+	if err := object.Db.Where("client_hw_addr = ? and client_id = ''", h.msg.ClientHWAddr.String()).First(&bind).Error; err != nil {
+		return nil, err
+	}
+	return &bind, nil
+}
+
+// 更新租约
+// 租约的主键为 (client_hw_addr, client_id), client_id 为空时 gorm 的 Save 会插入新的记录, 所以按照完整的主键更新
+func saveLease(lease *models.Leases) error {
+	return object.Db.Model(lease).Where("client_hw_addr = ? and client_id = ?", lease.ClientHWAddr, lease.ClientID).Select("*").Updates(lease).Error
+}
+
+// 支持 client identifier 之前记录的租约 client_id 为空, 发送 option 61 的客户端不会匹配到这些租约
+// 客户端还没有自己的租约时接管同一 mac 地址的旧租约, 避免升级之后客户端被分配新的地址或者续约被拒绝
+func (h *Handler) adoptLease() {
+	if h.clientID == "" {
+		return
+	}
+
+	var count int64
+	if err := object.Db.Model(&models.Leases{}).Where("client_id = ?", h.clientID).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+
+	hwAddr := h.msg.ClientHWAddr.String()
+	if err := object.Db.Model(&models.Leases{}).Where("client_hw_addr = ? and client_id = ''", hwAddr).Update("client_id", h.clientID).Error; err != nil {
+		log.WithFields(h.sign).Errorf("Error adopt lease of %s %s", hwAddr, err.Error())
+	}
+}
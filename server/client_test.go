@@ -0,0 +1,92 @@
+package server
+
+import (
+	"dhcp/models"
+	"dhcp/models/dbtest"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAdoptLease(t *testing.T) {
+	clientID := dhcpv4.WithOption(dhcpv4.OptClientIdentifier([]byte{0x01, 0x02}))
+	oldLease := models.Leases{
+		ClientHWAddr: testHWAddr.String(),
+		AssignedAddr: "10.1.1.20",
+		Subnet:       "test",
+		Expires:      time.Now().Add(time.Hour),
+	}
+	ownLease := oldLease
+	ownLease.ClientID = "0102"
+
+	tests := []struct {
+		name      string
+		leases    []interface{}
+		clientID  string
+		modifiers []dhcpv4.Modifier
+		adopted   bool
+	}{
+		{"lease stored before client identifier", []interface{}{oldLease}, "0102", []dhcpv4.Modifier{clientID}, true},
+		{"client already has a lease", []interface{}{oldLease, ownLease}, "0102", []dhcpv4.Modifier{clientID}, false},
+		{"client without client identifier", []interface{}{oldLease}, "", nil, false},
+	}
+	for _, test := range tests {
+		db := openTestDB(t, dbtest.Tables{"leases": test.leases})
+		h, _ := newTestHandler(dhcpv4.MessageTypeAck, test.modifiers...)
+		h.clientID = test.clientID
+		h.adoptLease()
+
+		updates := db.ExecsOn("UPDATE", "leases")
+		if !test.adopted {
+			if len(updates) != 0 {
+				t.Errorf("%s: unexpected update %s", test.name, updates[0].SQL)
+			}
+			continue
+		}
+		if len(updates) != 1 || !updates[0].Has("client_id = ''") || updates[0].Arg(0) != "0102" || updates[0].Arg(1) != testHWAddr.String() {
+			t.Errorf("%s: updates %v, want client_id of %s set to 0102", test.name, updates, testHWAddr)
+		}
+	}
+}
+
+// 升级之前的租约被接管之后, 客户端续约时得到原来的地址
+func TestRenewAdoptedLease(t *testing.T) {
+	lease := models.Leases{
+		ClientHWAddr: testHWAddr.String(),
+		ClientID:     "0102",
+		AssignedAddr: "10.1.1.20",
+		Subnet:       "test",
+		State:        models.LeaseStateBound,
+		Expires:      time.Now().Add(time.Hour),
+	}
+	db := openTestDB(t, dbtest.Tables{"leases": {lease}})
+	h, conn := newTestHandler(dhcpv4.MessageTypeAck, dhcpv4.WithClientIP(net.IP{10, 1, 1, 20}),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest), dhcpv4.WithOption(dhcpv4.OptClientIdentifier([]byte{0x01, 0x02})))
+	h.clientID = "0102"
+	h.AckHandler()
+
+	if len(conn.replies) != 1 || conn.replies[0].MessageType() != dhcpv4.MessageTypeAck {
+		t.Fatalf("replies %v, want DHCPACK", conn.replies)
+	}
+	if inserts := db.ExecsOn("INSERT", "leases"); len(inserts) != 0 {
+		t.Errorf("renewal inserted a lease: %s", inserts[0].SQL)
+	}
+}
+
+// client_id 为空的租约按照完整的主键更新, 而不是插入新的记录
+func TestSaveLease(t *testing.T) {
+	db := openTestDB(t, nil)
+	lease := models.Leases{ClientHWAddr: testHWAddr.String(), AssignedAddr: "10.1.1.20", Expires: time.Now()}
+	if err := saveLease(&lease); err != nil {
+		t.Fatal(err)
+	}
+
+	if inserts := db.ExecsOn("INSERT", "leases"); len(inserts) != 0 {
+		t.Errorf("saveLease inserted a lease: %s", inserts[0].SQL)
+	}
+	updates := db.ExecsOn("UPDATE", "leases")
+	if len(updates) != 1 || !updates[0].Has("client_hw_addr = ? and client_id = ?") {
+		t.Errorf("updates %v, want update by client_hw_addr and client_id", updates)
+	}
+}
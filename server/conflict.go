@@ -0,0 +1,95 @@
+package server
+
+import (
+	"dhcp/models"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"time"
+)
+
+// 没有配置 DeclineHoldTime 时冲突地址的隔离时间
+const defaultDeclineHoldTime = time.Hour
+
+// 返回冲突地址的隔离时间
+func (h *Handler) declineHoldTime() time.Duration {
+	if h.options.DeclineHoldTime == "" {
+		return defaultDeclineHoldTime
+	}
+	holdTime, err := time.ParseDuration(h.options.DeclineHoldTime)
+	if err != nil {
+		log.WithFields(h.sign).Errorf("Error decline hold time %s", err.Error())
+		return defaultDeclineHoldTime
+	}
+	return holdTime
+}
+
+// 将地址标记为冲突地址, 在隔离时间内不会被分配
+func (h *Handler) recordConflict(ip net.IP, reason string) {
+	conflict := models.Conflicts{
+		Address:      ip.String(),
+		ClientHWAddr: h.msg.ClientHWAddr.String(),
+		Reason:       reason,
+		Expires:      time.Now().Add(h.declineHoldTime()),
+	}
+	if h.subnet != nil {
+		conflict.Subnet = h.subnet.Name
+	}
+
+	log.WithFields(h.sign).Warningf("Address %s is marked as conflict (%s) until %s", conflict.Address, reason, conflict.Expires)
+	if err := object.Db.Save(&conflict).Error; err != nil {
+		log.WithFields(h.sign).Errorf("Error save conflict address %s", err.Error())
+	}
+}
+
+// 每个请求最多探测的地址数量, 超过之后不再探测, 避免一个 DHCPDISCOVER 被连续的探测超时阻塞
+const maxProbes = 3
+
+// 返回探测地址的超时时间
+func (h *Handler) pingTimeout() time.Duration {
+	if h.options.PingTimeout == "" {
+		return defaultPingTimeout
+	}
+	timeout, err := time.ParseDuration(h.options.PingTimeout)
+	if err != nil {
+		log.WithFields(h.sign).Errorf("Error ping timeout %s", err.Error())
+		return defaultPingTimeout
+	}
+	return timeout
+}
+
+// 分配新地址之前检查地址是否已被未登记的主机使用(例如手动配置了地址的主机)
+// 地址已被使用时将其标记为冲突地址并返回 true
+func (h *Handler) probeConflict(ip net.IP) bool {
+	if !h.options.PingCheck || h.messageType != dhcpv4.MessageTypeOffer {
+		return false
+	}
+
+	// 地址已有租约时不需要探测, 租约属于当前客户端时客户端自己可能会应答
+	if err := object.Db.Where("assigned_addr = ?", ip.String()).First(&models.Leases{}).Error; err == nil {
+		return false
+	}
+
+	if h.probes >= maxProbes {
+		log.WithFields(h.sign).Debugf("Probed %d addresses, offer %s without probing", h.probes, ip)
+		return false
+	}
+	h.probes++
+
+	inUse, err := addressInUse(ip, h.pingTimeout())
+	if err != nil {
+		log.WithFields(h.sign).Errorf("Error probe address %s %s", ip, err.Error())
+		return false
+	}
+	if inUse {
+		h.recordConflict(ip, models.ConflictReasonPing)
+	}
+	return inUse
+}
+
+// 地址是否处于冲突隔离期
+func isConflict(addr string) bool {
+	var conflict models.Conflicts
+	err := object.Db.Where("address = ? and unix_timestamp(expires) > ?", addr, time.Now().Unix()).First(&conflict).Error
+	return err == nil
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"net"
+	"testing"
+)
+
+// 达到探测数量上限之后不再探测, 地址直接视为可用
+func TestProbeConflictLimit(t *testing.T) {
+	db := openTestDB(t, nil)
+	h, _ := newTestHandler(dhcpv4.MessageTypeOffer)
+	h.options.PingCheck = true
+	h.probes = maxProbes
+
+	if h.probeConflict(net.IP{10, 1, 1, 20}) {
+		t.Error("probeConflict() = true after the probe limit")
+	}
+	if h.probes != maxProbes {
+		t.Errorf("probes = %d, want %d", h.probes, maxProbes)
+	}
+	if inserts := db.ExecsOn("INSERT", "conflicts"); len(inserts) != 0 {
+		t.Errorf("unexpected conflict %s", inserts[0].SQL)
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 客户端分类使用的匹配表达式
+//
+// 表达式由比较条件, and, or, not 和括号组成, 比较条件的格式为 字段 操作符 值, 值为双引号包含的字符串或者数字
+// 操作符: == != prefix suffix contains =~(正则表达式), 除正则表达式以外的比较不区分大小写
+// 字段:
+//   mac           客户端硬件地址(chaddr), 如 00:50:56:aa:bb:cc
+//   oui           硬件地址的前三个字节, 如 00:50:56
+//   vendor_class  option 60
+//   user_class    option 77, 多个 user class 以逗号(,)分隔
+//   arch          option 93 中的第一个架构类型(十进制)
+//   circuit_id    option 82 circuit-id
+//   remote_id     option 82 remote-id
+//   hostname      客户端发送的主机名
+//   client_id     option 61(十六进制字符串)
+//   option_N      任意选项 N 的值(十六进制字符串), 客户端没有发送时为空字符串
+// 示例: vendor_class prefix "PXEClient" and (arch == 7 or arch == 9)
+
+// 表达式的求值结果只依赖于客户端请求中的字段
+type classExpr interface {
+	eval(fields map[string]string) bool
+}
+
+type andExpr struct{ left, right classExpr }
+
+func (e *andExpr) eval(fields map[string]string) bool {
+	return e.left.eval(fields) && e.right.eval(fields)
+}
+
+type orExpr struct{ left, right classExpr }
+
+func (e *orExpr) eval(fields map[string]string) bool {
+	return e.left.eval(fields) || e.right.eval(fields)
+}
+
+type notExpr struct{ expr classExpr }
+
+func (e *notExpr) eval(fields map[string]string) bool {
+	return !e.expr.eval(fields)
+}
+
+type compareExpr struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (e *compareExpr) eval(fields map[string]string) bool {
+	field := fields[e.field]
+	switch e.op {
+	case "==":
+		return strings.EqualFold(field, e.value)
+	case "!=":
+		return !strings.EqualFold(field, e.value)
+	case "prefix":
+		return strings.HasPrefix(strings.ToLower(field), strings.ToLower(e.value))
+	case "suffix":
+		return strings.HasSuffix(strings.ToLower(field), strings.ToLower(e.value))
+	case "contains":
+		return strings.Contains(strings.ToLower(field), strings.ToLower(e.value))
+	case "=~":
+		return e.re.MatchString(field)
+	}
+	return false
+}
+
+// 可以在表达式中使用的字段
+var classFields = map[string]bool{
+	"mac":          true,
+	"oui":          true,
+	"vendor_class": true,
+	"user_class":   true,
+	"arch":         true,
+	"circuit_id":   true,
+	"remote_id":    true,
+	"hostname":     true,
+	"client_id":    true,
+}
+
+var optionFieldPattern = regexp.MustCompile(`^option_([1-9][0-9]?|1[0-9][0-9]|2[0-4][0-9]|25[0-4])$`)
+
+// 表达式的词法单元, 字符串字面量以 " 开头
+type exprToken string
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, exprToken(c))
+			i++
+		case strings.HasPrefix(s[i:], "==") || strings.HasPrefix(s[i:], "!=") || strings.HasPrefix(s[i:], "=~"):
+			tokens = append(tokens, exprToken(s[i:i+2]))
+			i += 2
+		case c == '"':
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				value.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string in expression")
+			}
+			tokens = append(tokens, exprToken(`"`+value.String()))
+			i = j + 1
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, exprToken(s[i:j]))
+			i = j
+		default:
+			return nil, errors.New(fmt.Sprintf("unexpected character %q in expression", c))
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() exprToken {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *exprParser) parseOr() (classExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (classExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (classExpr, error) {
+	if p.peek() == "not" {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (classExpr, error) {
+	if p.peek() == "(" {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing ) in expression")
+		}
+		return expr, nil
+	}
+
+	field := string(p.next())
+	if !classFields[field] && !optionFieldPattern.MatchString(field) {
+		return nil, errors.New(fmt.Sprintf("unknown field %q in expression", field))
+	}
+
+	op := string(p.next())
+	switch op {
+	case "==", "!=", "prefix", "suffix", "contains", "=~":
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown operator %q in expression", op))
+	}
+
+	value := string(p.next())
+	switch {
+	case strings.HasPrefix(value, `"`):
+		value = value[1:]
+	case value != "" && strings.IndexFunc(value, func(r rune) bool { return !unicode.IsDigit(r) }) == -1:
+	default:
+		return nil, errors.New(fmt.Sprintf("invalid value %q in expression", value))
+	}
+
+	expr := &compareExpr{field: field, op: op, value: value}
+	if op == "=~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		expr.re = re
+	}
+	return expr, nil
+}
+
+// 解析匹配表达式
+func parseClassExpr(s string) (classExpr, error) {
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(tokens) {
+		return nil, errors.New(fmt.Sprintf("unexpected %q in expression", p.peek()))
+	}
+	return expr, nil
+}
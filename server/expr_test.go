@@ -0,0 +1,122 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeExpr(t *testing.T) {
+	tests := []struct {
+		expr   string
+		tokens []exprToken
+	}{
+		{`mac == "00:50:56"`, []exprToken{"mac", "==", `"00:50:56`}},
+		{`(arch!=7)`, []exprToken{"(", "arch", "!=", "7", ")"}},
+		{`hostname =~ "^web-\\d+$"`, []exprToken{"hostname", "=~", `"^web-\d+$`}},
+		{`vendor_class == "a\"b"`, []exprToken{"vendor_class", "==", `"a"b`}},
+		{`option_60 == ""`, []exprToken{"option_60", "==", `"`}},
+		{"  not\tmac  ", []exprToken{"not", "mac"}},
+	}
+	for _, test := range tests {
+		tokens, err := tokenizeExpr(test.expr)
+		if err != nil {
+			t.Errorf("tokenizeExpr(%q) error %s", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("tokenizeExpr(%q) = %q, want %q", test.expr, tokens, test.tokens)
+		}
+	}
+}
+
+func TestParseClassExprEval(t *testing.T) {
+	fields := map[string]string{
+		"mac":          "00:50:56:aa:bb:cc",
+		"oui":          "00:50:56",
+		"vendor_class": "PXEClient:Arch:00007:UNDI:003016",
+		"user_class":   "iPXE",
+		"arch":         "7",
+		"hostname":     "web-01",
+		"option_60":    "505845436c69656e74",
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// 比较操作符, 除正则表达式以外不区分大小写
+		{`oui == "00:50:56"`, true},
+		{`oui == "00:50:57"`, false},
+		{`user_class == "ipxe"`, true},
+		{`user_class != "ipxe"`, false},
+		{`arch == 7`, true},
+		{`arch == 9`, false},
+		{`remote_id == ""`, true},
+		{`remote_id != ""`, false},
+		// 子串匹配
+		{`vendor_class prefix "pxeclient"`, true},
+		{`vendor_class prefix "HTTPClient"`, false},
+		{`vendor_class suffix "undi:003016"`, true},
+		{`vendor_class suffix "PXEClient"`, false},
+		{`vendor_class contains "arch:00007"`, true},
+		{`vendor_class contains "Arch:00009"`, false},
+		{`hostname contains ""`, true},
+		// 正则表达式区分大小写
+		{`hostname =~ "^web-[0-9]+$"`, true},
+		{`hostname =~ "^WEB-"`, false},
+		{`option_60 == "505845436C69656E74"`, true},
+		{`option_61 == ""`, true},
+		// not, and, or 和优先级: not > and > or
+		{`not arch == 9`, true},
+		{`not not arch == 7`, true},
+		{`arch == 9 or arch == 7`, true},
+		{`arch == 7 and arch == 9`, false},
+		{`arch == 7 or arch == 9 and oui == "ff:ff:ff"`, true},
+		{`(arch == 7 or arch == 9) and oui == "ff:ff:ff"`, false},
+		{`arch == 9 and oui == "00:50:56" or user_class == "iPXE"`, true},
+		{`arch == 9 and (oui == "00:50:56" or user_class == "iPXE")`, false},
+		{`not arch == 7 or hostname == "web-01"`, true},
+		{`not (arch == 7 or hostname == "web-01")`, false},
+		{`not arch == 7 and hostname == "web-01"`, false},
+		{`vendor_class prefix "PXEClient" and (arch == 7 or arch == 9) and not user_class == "iPXE"`, false},
+	}
+	for _, test := range tests {
+		expr, err := parseClassExpr(test.expr)
+		if err != nil {
+			t.Errorf("parseClassExpr(%q) error %s", test.expr, err)
+			continue
+		}
+		if got := expr.eval(fields); got != test.want {
+			t.Errorf("parseClassExpr(%q).eval() = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestParseClassExprMalformed(t *testing.T) {
+	tests := []string{
+		``,
+		`   `,
+		`mac`,
+		`mac ==`,
+		`mac == 00:50:56`,
+		`mac == "00:50:56`,
+		`unknown == "a"`,
+		`option_0 == ""`,
+		`option_255 == ""`,
+		`mac substring "00"`,
+		`mac = "00"`,
+		`arch == 7a`,
+		`(arch == 7`,
+		`arch == 7)`,
+		`arch == 7 and`,
+		`or arch == 7`,
+		`not`,
+		`arch == 7 arch == 9`,
+		`hostname =~ "("`,
+		`mac == "a" & arch == 7`,
+	}
+	for _, expr := range tests {
+		if _, err := parseClassExpr(expr); err == nil {
+			t.Errorf("parseClassExpr(%q) expected error", expr)
+		}
+	}
+}
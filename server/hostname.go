@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strings"
+)
+
+// client FQDN(option 81) 标志位(RFC 4702 2.1)
+const (
+	fqdnFlagS byte = 0x01
+	fqdnFlagO byte = 0x02
+	fqdnFlagE byte = 0x04
+	fqdnFlagN byte = 0x08
+)
+
+// 客户端发送的 client FQDN(option 81)
+type clientFQDN struct {
+	flags byte
+	name  string
+}
+
+// 解析客户端发送的 option 81, 域名按照 E 标志位使用 DNS 编码或者 ASCII 编码
+func parseClientFQDN(req *dhcpv4.DHCPv4) *clientFQDN {
+	data := req.Options.Get(dhcpv4.OptionFQDN)
+	if len(data) < 3 {
+		return nil
+	}
+
+	fqdn := &clientFQDN{flags: data[0]}
+	if fqdn.flags&fqdnFlagE == 0 {
+		fqdn.name = strings.TrimSuffix(string(data[3:]), ".")
+		return fqdn
+	}
+	labels, err := rfc1035label.FromBytes(data[3:])
+	if err == nil && len(labels.Labels) > 0 {
+		fqdn.name = strings.TrimSuffix(labels.Labels[0], ".")
+	}
+	return fqdn
+}
+
+// 客户端发送的主机名, 优先使用 option 12, 其次是 option 81 中的域名
+func clientHostname(req *dhcpv4.DHCPv4) string {
+	if hostname := req.HostName(); hostname != "" {
+		return hostname
+	}
+	if fqdn := parseClientFQDN(req); fqdn != nil {
+		return fqdn.name
+	}
+	return ""
+}
+
+// 客户端发送的主机名被保存到租约中并用于生成启动配置, 不合法(RFC 1123)时返回空字符串
+func validClientHostname(req *dhcpv4.DHCPv4) string {
+	hostname := strings.TrimSuffix(clientHostname(req), ".")
+	if hostname == "" || CheckHostname(hostname) != nil {
+		return ""
+	}
+	return hostname
+}
+
+// 使用主机名模板生成主机名
+func expandHostname(pattern string, hwAddr net.HardwareAddr, ip net.IP) string {
+	hostname := strings.ReplaceAll(pattern, "{mac}", strings.ReplaceAll(hwAddr.String(), ":", ""))
+	if ip != nil {
+		hostname = strings.ReplaceAll(hostname, "{ip}", strings.ReplaceAll(ip.String(), ".", "-"))
+	}
+	return hostname
+}
+
+// 分配给客户端的主机名, 绑定的主机名优先于地址池的主机名模板, 都没有时返回空字符串
+func (h *Handler) assignedHostname(ip net.IP) string {
+	if bind, err := h.queryBinding(); err == nil && bind.Hostname != "" {
+		return bind.Hostname
+	}
+	if h.subnet.HostnamePattern == "" {
+		return ""
+	}
+	return expandHostname(h.subnet.HostnamePattern, h.req.ClientHWAddr, ip)
+}
+
+// 设置主机名(option 12)并回应客户端的 client FQDN(option 81)
+// 服务器不更新 DNS 记录, 所以回应中 S 为 0, N 为 1, 客户端要求服务器更新时 O 为 1
+func (h *Handler) withHostname(ip net.IP) {
+	hostname := h.assignedHostname(ip)
+	if hostname != "" {
+		h.msg.UpdateOption(dhcpv4.OptHostName(hostname))
+	}
+
+	fqdn := parseClientFQDN(h.req)
+	if fqdn == nil {
+		return
+	}
+	flags := fqdn.flags&fqdnFlagE | fqdnFlagN
+	if fqdn.flags&fqdnFlagS != 0 {
+		flags |= fqdnFlagO
+	}
+	name := fqdn.name
+	if hostname != "" {
+		name = hostname
+	}
+
+	// RCODE1 和 RCODE2 固定为 255
+	value := []byte{flags, 255, 255}
+	if flags&fqdnFlagE != 0 {
+		value = append(value, (&rfc1035label.Labels{Labels: []string{name}}).ToBytes()...)
+	} else {
+		value = append(value, name...)
+	}
+	h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionFQDN, value))
+	log.WithFields(h.sign).Debugf("Client FQDN %s, reply %s", fqdn.name, name)
+}
+
+// 检查主机名是否合法(RFC 1123), 允许包含域名
+func CheckHostname(hostname string) error {
+	if len(hostname) > 253 {
+		return errors.New("hostname is too long")
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return errors.New(fmt.Sprintf("invalid hostname %s", hostname))
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return errors.New(fmt.Sprintf("invalid hostname %s", hostname))
+			}
+		}
+	}
+	return nil
+}
+
+// 检查主机名模板是否合法, 留空表示不生成主机名
+func CheckHostnamePattern(pattern string) error {
+	if pattern == "" {
+		return nil
+	}
+	hwAddr := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	return CheckHostname(expandHostname(pattern, hwAddr, net.IPv4zero))
+}
@@ -17,13 +17,23 @@ var (
 	OptionsCacheLock sync.Mutex
 )
 
+// 没有配置 OfferHoldTime 时 DHCPOFFER 保留地址的时间
+const defaultOfferHoldTime = 30 * time.Second
+
 type Handler struct {
 	conn        net.PacketConn
 	peer        net.Addr
+	req         *dhcpv4.DHCPv4
 	msg         *dhcpv4.DHCPv4
 	messageType dhcpv4.MessageType
 	sign        log.Fields
 	options     *models.Options
+	subnet      *models.Subnet
+	relay       *relayInfo
+	clientID    string
+	class       *models.ClientClass
+	// 处理当前请求时已经探测的地址数量
+	probes int
 }
 
 // 从数据库查询配置, 如果查询出现错误则读取上次查询的结果
@@ -43,99 +53,202 @@ func QueryOptions() *models.Options {
 	return &options
 }
 
-func NewHandler(conn net.PacketConn, peer net.Addr, msg *dhcpv4.DHCPv4, msgType dhcpv4.MessageType, sign log.Fields) *Handler {
+func NewHandler(conn net.PacketConn, peer net.Addr, req, msg *dhcpv4.DHCPv4, msgType dhcpv4.MessageType, class *models.ClientClass, sign log.Fields) *Handler {
 	options := QueryOptions()
-	return &Handler{
+	h := &Handler{
 		conn:        conn,
 		peer:        peer,
+		req:         req,
 		msg:         msg,
 		messageType: msgType,
 		sign:        sign,
 		options:     options,
+		subnet:      selectSubnet(req, options),
+		relay:       parseRelayInfo(req),
+		clientID:    clientIdentifier(req, options),
+		class:       class,
 	}
+	h.adoptLease()
+	return h
 }
 
 func (h *Handler) OfferHandler() {
 	h.withReplyHandler()
 }
 
-func (h *Handler) AckHandler() {
-	h.withReplyHandler()
+// 响应 DHCPINFORM, 客户端已经配置了地址, 只返回地址池的配置信息, 不分配地址也不记录租约(RFC 2131 3.4)
+func (h *Handler) InformHandler() {
+	network, ok := h.subnetNetwork()
+	if !ok {
+		return
+	}
+
+	h.withConfigOptions(network)
+	h.withHostname(h.req.ClientIPAddr)
+	h.withCustomOptions()
+	h.msg.ClientIPAddr = h.req.ClientIPAddr
+
+	log.WithFields(h.sign).Debug(h.msg)
+
+	h.writeReply()
 }
 
 func (h *Handler) withReplyHandler() {
-	// 设置租约时间
-	leaseTime, err := time.ParseDuration(h.options.LeaseTime)
-	if err != nil {
-		log.WithFields(h.sign).Errorf("Error lease generation time %s", err.Error())
+	network, ok := h.subnetNetwork()
+	if !ok {
 		return
 	}
 
 	// 获取将要分配给客户端的地址
-	assignedIP, err := h.createIP(h.options.RangeStartIP, h.options.RangeEndIP)
+	assignedIP, err := h.createIP(network)
 	if err != nil {
 		log.WithFields(h.sign).Errorf("Error create IP assigned to client %s", err.Error())
 		return
 	}
 
-	// 解析子网掩码
-	subnetMask, err := getNetmask(h.options.NetMask)
+	h.replyWithIP(network, assignedIP)
+}
+
+// 构建并发送分配了地址的响应包(DHCPOFFER 或 DHCPACK)
+func (h *Handler) replyWithIP(network *net.IPNet, assignedIP net.IP) {
+	// 设置租约时间
+	leaseTime, err := h.leaseTime()
 	if err != nil {
-		log.WithFields(h.sign).Errorf("Error parsing subnet mask %s", err.Error())
+		log.WithFields(h.sign).Errorf("Error lease generation time %s", err.Error())
 		return
 	}
 
-	router := parse(h.options.Router)
-	dns := parse(h.options.DNS)
-
 	// 构建 dhcp 响应包
-	h.msg.UpdateOption(dhcpv4.OptMessageType(h.messageType))
-	h.msg.UpdateOption(dhcpv4.OptServerIdentifier(net.ParseIP(h.options.ServerIP)))
+	h.withConfigOptions(network)
+	renewalTime, rebindingTime := h.renewalTimes(leaseTime)
 	h.msg.UpdateOption(dhcpv4.OptIPAddressLeaseTime(leaseTime))
-	h.msg.UpdateOption(dhcpv4.OptSubnetMask(subnetMask))
-	h.msg.UpdateOption(dhcpv4.OptRouter(router...))
-	h.msg.UpdateOption(dhcpv4.OptDNS(dns...))
-	h.msg.BootFileName = h.options.BootFileName
+	h.msg.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionRenewTimeValue, Value: dhcpv4.Duration(renewalTime)})
+	h.msg.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionRebindingTimeValue, Value: dhcpv4.Duration(rebindingTime)})
+	h.withHostname(assignedIP)
+	h.withCustomOptions()
 	h.msg.YourIPAddr = assignedIP
-	h.msg.ServerIPAddr = net.ParseIP(h.options.ServerIP)
-	h.msg.GatewayIPAddr = net.ParseIP(h.options.GatewayIP)
+	h.msg.ClientIPAddr = h.req.ClientIPAddr
+
+	log.WithFields(h.sign).Debug(h.msg)
+
+	h.writeReply()
+}
+
+// 返回为客户端选择的地址池所在的子网, 没有匹配的地址池时返回 false
+func (h *Handler) subnetNetwork() (*net.IPNet, bool) {
+	if h.subnet == nil {
+		log.WithFields(h.sign).Warningf("No subnet matched the client request")
+		return nil, false
+	}
+	h.sign["subnet"] = h.subnet.Name
+
+	network, err := parseCIDR(h.subnet.CIDR)
+	if err != nil {
+		log.WithFields(h.sign).Errorf("Error parsing subnet %s", err.Error())
+		return nil, false
+	}
+	return network, true
+}
 
-	log.Error(h.msg)
+// 设置地址池的配置信息(子网掩码, 路由, DNS, 启动文件等)
+func (h *Handler) withConfigOptions(network *net.IPNet) {
+	router := parse(h.subnet.Router)
+	dns := parse(h.subnet.DNS)
 
-	if _, err := h.conn.WriteTo(h.msg.ToBytes(), h.peer); err != nil {
-		log.WithFields(h.sign).Errorf("Error Write DHCP reply message %s", err.Error())
+	h.msg.UpdateOption(dhcpv4.OptMessageType(h.messageType))
+	h.msg.UpdateOption(dhcpv4.OptServerIdentifier(net.ParseIP(h.subnet.ServerIP)))
+	h.msg.UpdateOption(dhcpv4.OptSubnetMask(network.Mask))
+	h.msg.UpdateOption(dhcpv4.OptRouter(router...))
+	h.msg.UpdateOption(dhcpv4.OptDNS(dns...))
+	h.withNetworkOptions(network)
+	h.withPXEOptions()
+	h.msg.BootFileName, h.msg.ServerIPAddr = h.bootConfig()
+	// 启动文件字段只有 128 个字节, 较长的启动文件(如 URL)同时通过 option 67 发送
+	if len(h.msg.BootFileName) > 127 {
+		h.msg.UpdateOption(dhcpv4.OptBootFileName(h.msg.BootFileName))
 	}
 }
 
 // 分配一个IP地址给客户端
-func (h *Handler) createIP(rangeStart string, rangeEnd string) (net.IP, error) {
-	var bind models.Binding
+func (h *Handler) createIP(network *net.IPNet) (net.IP, error) {
 	var lease models.Leases
 
-	// 检查这个客户端是否有绑定的IP地址
-	if err := object.Db.Where("client_hw_addr = ?", h.msg.ClientHWAddr.String()).First(&bind).Error; err == nil {
-		// 如果 checkLeases 返回 true, 且 err 为 nil 则表示绑定的 IP 地址被分配了给其他机器
-		if h.checkLeases(bind.BindAddr) {
-			return nil, errors.New("the bound IP address is assigned to another machine")
+	// 检查这个客户端是否有绑定的IP地址(绑定的地址必须属于当前地址池所在的子网)
+	if bind, err := h.queryBinding(); err == nil {
+		if !network.Contains(net.ParseIP(bind.BindAddr)) {
+			log.WithFields(h.sign).Warningf("The bound IP address %s is not in subnet %s", bind.BindAddr, h.subnet.CIDR)
+		} else {
+			// 如果 checkLeases 返回 true, 且 err 为 nil 则表示绑定的 IP 地址被分配了给其他机器
+			if h.checkLeases(bind.BindAddr) {
+				return nil, errors.New("the bound IP address is assigned to another machine")
+			}
+			return net.ParseIP(bind.BindAddr), nil
+		}
+	}
+
+	// 检查客户端接入的交换机端口(option 82)是否有绑定的IP地址
+	if h.relay != nil && h.relay.circuitID != "" {
+		if relayBind, err := queryRelayBinding(h.relay); err == nil {
+			if !network.Contains(net.ParseIP(relayBind.BindAddr)) {
+				log.WithFields(h.sign).Warningf("The relay bound IP address %s is not in subnet %s", relayBind.BindAddr, h.subnet.CIDR)
+			} else {
+				return h.relayBindIP(relayBind.BindAddr)
+			}
 		}
-		return net.ParseIP(bind.BindAddr), nil
 	}
 
 	// 检查这个客户端是否已经分配了IP地址(如果已经分配则按照续约请求处理)
-	if err := object.Db.Where("client_hw_addr = ?", h.msg.ClientHWAddr.String()).First(&lease).Error; err == nil {
-		options := QueryOptions()
-		leaseTime, err := time.ParseDuration(options.LeaseTime)
-		if err != nil {
-			return nil, errors.New(fmt.Sprintf("lease generation time %s", err.Error()))
+	if err := h.whereClient(object.Db).First(&lease).Error; err == nil {
+		// 客户端已经移动到了其他子网, 删除旧的租约重新分配
+		if !network.Contains(net.ParseIP(lease.AssignedAddr)) {
+			if err := object.Db.Unscoped().Delete(&lease).Error; err != nil {
+				return nil, errors.New(fmt.Sprintf("delete lease info %s", err.Error()))
+			}
+			return h.assignedIP()
 		}
 
-		lease.Expires = time.Now().Add(leaseTime)
-		if err := object.Db.Save(&lease).Error; err != nil {
+		if err := h.updateLeaseInfo(&lease); err != nil {
+			return nil, err
+		}
+		if err := saveLease(&lease); err != nil {
 			return nil, errors.New(fmt.Sprintf("update lease info %s", err.Error()))
 		}
 		return net.ParseIP(lease.AssignedAddr), nil
 	}
-	return h.assignedIP(rangeStart, rangeEnd)
+	return h.assignedIP()
+}
+
+// 分配交换机端口绑定的地址, 地址与地址池中的其他地址一样需要通过保留和冲突检查
+// 之前从此端口接入的客户端的租约仍然有效时拒绝分配, 等待其释放或者到期, 避免两台客户端使用同一个地址
+func (h *Handler) relayBindIP(addr string) (net.IP, error) {
+	ip := net.ParseIP(addr)
+	if h.checkUnavailable(ip) {
+		return nil, errors.New(fmt.Sprintf("the relay bound IP address %s is not available", addr))
+	}
+	if h.leasedToOther(addr) {
+		return nil, errors.New(fmt.Sprintf("the relay bound IP address %s is leased to another machine", addr))
+	}
+
+	// 客户端从其他端口移动到了此端口, 删除客户端其他地址的租约
+	if err := h.whereClient(object.Db.Unscoped()).Where("assigned_addr <> ?", addr).Delete(&models.Leases{}).Error; err != nil {
+		return nil, errors.New(fmt.Sprintf("delete lease info %s", err.Error()))
+	}
+	if h.checkLeases(addr) {
+		return nil, errors.New("the relay bound IP address is assigned to another machine")
+	}
+	return ip, nil
+}
+
+// 地址是否被其他客户端的有效租约占用
+func (h *Handler) leasedToOther(addr string) bool {
+	var lease models.Leases
+	if err := object.Db.Where("assigned_addr = ? and unix_timestamp(expires) > ?", addr, time.Now().Unix()).First(&lease).Error; err != nil {
+		return false
+	}
+	if h.clientID != "" {
+		return lease.ClientID != h.clientID
+	}
+	return lease.ClientID != "" || lease.ClientHWAddr != h.msg.ClientHWAddr.String()
 }
 
 // 如果 addr 存在且 clientHW 相同则更新租约到期时间，并返回 false
@@ -144,32 +257,37 @@ func (h *Handler) createIP(rangeStart string, rangeEnd string) (net.IP, error) {
 func (h *Handler) checkLeases(addr string) bool {
 	var lease models.Leases
 
-	options := QueryOptions()
-
-	leaseTime, err := time.ParseDuration(options.LeaseTime)
-	if err != nil {
-		log.WithFields(h.sign).Errorf("Error lease generation time %s", err.Error())
-		return true
-	}
-
 	// addr 存在且 clientHW 相同
-	if err := object.Db.Where("assigned_addr = ? and client_hw_addr = ?", addr, h.msg.ClientHWAddr.String()).First(&lease).Error; err == nil {
-		lease.Expires = time.Now().Add(leaseTime)
-		if err := object.Db.Save(&lease).Error; err != nil {
+	if err := h.whereClient(object.Db).Where("assigned_addr = ?", addr).First(&lease).Error; err == nil {
+		if err := h.updateLeaseInfo(&lease); err != nil {
+			log.WithFields(h.sign).Errorf("Error update lease info %s", err.Error())
+			return true
+		}
+		if err := saveLease(&lease); err != nil {
 			log.WithFields(h.sign).Errorf("Error update lease expires %s", err.Error())
 			return true
 		}
 		return false
 	}
 
-	// addr 存在且 clientHW 不同，且expires值小于当前时间（表示此地址已经被分配给别的主机）
-	if err := object.Db.Where("assigned_addr = ?", addr, time.Now().Unix()).First(&lease).Error; err == nil {
+	// addr 存在且 clientHW 不同，且expires值大于当前时间（表示此地址已经被分配给别的主机）
+	if err := object.Db.Where("assigned_addr = ? and unix_timestamp(expires) > ?", addr, time.Now().Unix()).First(&lease).Error; err == nil {
+		return true
+	}
+
+	// 删除已经过期但还没有被定时任务清理的租约(例如超时未确认的 DHCPOFFER)
+	if err := object.Db.Unscoped().Where("assigned_addr = ?", addr).Delete(&models.Leases{}).Error; err != nil {
+		log.WithFields(h.sign).Errorf("Error delete expired lease %s", err.Error())
 		return true
 	}
 
-	lease.Expires = time.Now().Add(leaseTime)
 	lease.AssignedAddr = addr
 	lease.ClientHWAddr = h.msg.ClientHWAddr.String()
+	lease.ClientID = h.clientID
+	if err := h.updateLeaseInfo(&lease); err != nil {
+		log.WithFields(h.sign).Errorf("Error update lease info %s", err.Error())
+		return true
+	}
 	if err := object.Db.Create(&lease).Error; err != nil {
 		log.WithFields(h.sign).Errorf("Error create lease info %s", err.Error())
 		return true
@@ -177,29 +295,213 @@ func (h *Handler) checkLeases(addr string) bool {
 	return false
 }
 
+// 返回分配给客户端的租约时间
+// 配置了租约时间范围时使用客户端请求的租约时间(option 51), 并限制在范围之内
+// 只配置了上限时下限为 0, 只配置了下限时上限为地址池的租约时间
+func (h *Handler) leaseTime() (time.Duration, error) {
+	leaseTime, err := time.ParseDuration(h.subnet.LeaseTime)
+	if err != nil {
+		return 0, err
+	}
+
+	requested := h.req.IPAddressLeaseTime(0)
+	if requested == 0 || (h.subnet.MinLeaseTime == "" && h.subnet.MaxLeaseTime == "") {
+		return leaseTime, nil
+	}
+
+	minLeaseTime, maxLeaseTime := time.Duration(0), leaseTime
+	if h.subnet.MinLeaseTime != "" {
+		if minLeaseTime, err = time.ParseDuration(h.subnet.MinLeaseTime); err != nil {
+			return 0, err
+		}
+	}
+	if h.subnet.MaxLeaseTime != "" {
+		if maxLeaseTime, err = time.ParseDuration(h.subnet.MaxLeaseTime); err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case requested < minLeaseTime:
+		return minLeaseTime, nil
+	case requested > maxLeaseTime:
+		return maxLeaseTime, nil
+	default:
+		return requested, nil
+	}
+}
+
+// 检查租约时间范围, 下限不能大于上限, 只配置了下限时上限为租约时间(leaseTime 为空时不检查)
+func CheckLeaseTimeRange(leaseTime, minLeaseTime, maxLeaseTime string) error {
+	if minLeaseTime == "" {
+		return nil
+	}
+	if maxLeaseTime == "" {
+		maxLeaseTime = leaseTime
+	}
+	if maxLeaseTime == "" {
+		return nil
+	}
+
+	min, err := time.ParseDuration(minLeaseTime)
+	if err != nil {
+		return err
+	}
+	max, err := time.ParseDuration(maxLeaseTime)
+	if err != nil {
+		return err
+	}
+	if min > max {
+		return errors.New(fmt.Sprintf("min lease time %s is greater than max lease time %s", minLeaseTime, maxLeaseTime))
+	}
+	return nil
+}
+
+// 返回续约时间(T1)和重新绑定时间(T2), 必须满足 T1 < T2 < 租约时间(RFC 2131 4.4.5)
+// 没有配置或者配置的值不满足要求时分别为租约时间的 50% 和 87.5%
+func (h *Handler) renewalTimes(leaseTime time.Duration) (time.Duration, time.Duration) {
+	t1 := leaseTime / 2
+	t2 := leaseTime * 7 / 8
+
+	if h.subnet.RenewalTime != "" {
+		if renewal, err := time.ParseDuration(h.subnet.RenewalTime); err == nil && renewal < leaseTime {
+			t1 = renewal
+		}
+	}
+	if h.subnet.RebindingTime != "" {
+		if rebinding, err := time.ParseDuration(h.subnet.RebindingTime); err == nil && rebinding < leaseTime {
+			t2 = rebinding
+		}
+	}
+
+	if t1 >= t2 {
+		return leaseTime / 2, leaseTime * 7 / 8
+	}
+	return t1, t2
+}
+
+// 返回 DHCPOFFER 之后为客户端保留地址的时间
+func (h *Handler) offerHoldTime() (time.Duration, error) {
+	if h.options.OfferHoldTime == "" {
+		return defaultOfferHoldTime, nil
+	}
+	return time.ParseDuration(h.options.OfferHoldTime)
+}
+
+// 记录客户端所在的地址池和接入的交换机端口, 并根据响应类型更新租约状态
+// DHCPOFFER 只在短时间内为客户端保留地址, 发送 DHCPACK 之后才成为正式租约
+// 已经生效的租约在客户端重新发送 DHCPDISCOVER 时保持不变
+func (h *Handler) updateLeaseInfo(lease *models.Leases) error {
+	lease.Subnet = h.subnet.Name
+	// 续约请求中通常不带主机名, 只在客户端发送了合法的主机名时更新
+	if hostname := validClientHostname(h.req); hostname != "" {
+		lease.Hostname = hostname
+	}
+	lease.ClientClass = ""
+	if h.class != nil {
+		lease.ClientClass = h.class.Name
+	}
+	// 操作系统续约时不发送 option 93, 只在客户端发送了架构类型时更新
+	if arch, ok := clientArch(h.req); ok {
+		lease.Arch = arch.String()
+	}
+	if h.relay != nil {
+		lease.CircuitID = h.relay.circuitID
+		lease.RemoteID = h.relay.remoteID
+	}
+
+	if h.messageType == dhcpv4.MessageTypeOffer {
+		if lease.State != models.LeaseStateOffered && lease.Expires.After(time.Now()) {
+			return nil
+		}
+		holdTime, err := h.offerHoldTime()
+		if err != nil {
+			return errors.New(fmt.Sprintf("offer hold time %s", err.Error()))
+		}
+		lease.State = models.LeaseStateOffered
+		lease.Expires = time.Now().Add(holdTime)
+		return nil
+	}
+
+	leaseTime, err := h.leaseTime()
+	if err != nil {
+		return errors.New(fmt.Sprintf("lease generation time %s", err.Error()))
+	}
+	lease.State = models.LeaseStateBound
+	lease.Expires = time.Now().Add(leaseTime)
+	return nil
+}
+
 // 检查IP是否已被分配, 返回true表示已分配
 func (h *Handler) checkIfTaken(ip net.IP) bool {
 	var bind models.Binding
-	var reserve models.Reserves
+	var relayBind models.RelayBinding
 	addr := ip.String()
 	if err := object.Db.Where("bind_addr = ?", addr).First(&bind).Error; err == nil {
 		return true
 	}
 
-	if err := object.Db.Where("address = ?", addr).First(&reserve).Error; err == nil {
+	if err := object.Db.Where("bind_addr = ?", addr).First(&relayBind).Error; err == nil {
+		return true
+	}
+
+	if h.checkUnavailable(ip) {
 		return true
 	}
 
 	return h.checkLeases(addr)
 }
 
+// 地址是否为保留地址, 处于冲突隔离期, 或者探测到已被使用
+func (h *Handler) checkUnavailable(ip net.IP) bool {
+	var reserve models.Reserves
+	addr := ip.String()
+	if err := object.Db.Where("address = ?", addr).First(&reserve).Error; err == nil {
+		return true
+	}
+
+	if isConflict(addr) {
+		return true
+	}
+
+	return h.probeConflict(ip)
+}
+
+// 客户端请求的地址(option 50)在地址池的可分配地址段中且空闲时直接分配给客户端, 否则返回 nil
+// 例如租约被定时任务清理之后, 客户端仍然可以拿回原来的地址
+func (h *Handler) requestedIP() net.IP {
+	requested := h.req.RequestedIPAddress()
+	if requested == nil || !h.inRanges(requested) {
+		return nil
+	}
+	if h.checkIfTaken(requested) {
+		log.WithFields(h.sign).Debugf("Requested address %s is not available", requested)
+		return nil
+	}
+	return requested.To4()
+}
+
+// 依次从地址池的各个地址段中获取一个可用的IP地址, 优先分配客户端请求的地址
+func (h *Handler) assignedIP() (net.IP, error) {
+	if ip := h.requestedIP(); ip != nil {
+		return ip, nil
+	}
+
+	ranges, err := h.poolRanges()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ranges {
+		if ip, err := h.assignedIPFromRange(r.start, r.end); err == nil {
+			return ip, nil
+		}
+	}
+	return nil, errors.New("no new ip addresses available")
+}
+
 // 从可分配的IP地址返回随机获取一个可用的IP地址
-func (h *Handler) assignedIP(rangeStart string, rangeEnd string) (net.IP, error) {
+func (h *Handler) assignedIPFromRange(rangeStartInt uint32, rangeEndInt uint32) (net.IP, error) {
 	ip := make([]byte, 4)
-	start := net.ParseIP(rangeStart)
-	end := net.ParseIP(rangeEnd)
-	rangeStartInt := binary.BigEndian.Uint32(start.To4())
-	rangeEndInt := binary.BigEndian.Uint32(end.To4())
 	binary.BigEndian.PutUint32(ip, random(rangeStartInt, rangeEndInt))
 	taken := h.checkIfTaken(ip)
 	for taken {
@@ -227,14 +529,42 @@ func (h *Handler) ReleaseHandler() {
 	h.withReleaseAddress("ReleaseHandler")
 }
 
+// 客户端发现分配的地址已被使用, 删除客户端的租约并将地址标记为冲突地址
 func (h *Handler) DeclineHandler() {
-	h.withReleaseAddress("DeclineHandler")
+	// 发送给其他服务器的 DHCPDECLINE
+	if serverID := h.req.ServerIdentifier(); serverID != nil && h.subnet != nil && !h.isServerID(serverID) {
+		return
+	}
+
+	// 只处理客户端自己持有的地址, 避免伪造的 DHCPDECLINE 释放其他客户端的租约
+	query := h.whereClient(object.Db)
+	if addr := h.req.RequestedIPAddress(); addr != nil {
+		query = query.Where("assigned_addr = ?", addr.String())
+	}
+	var lease models.Leases
+	if err := query.First(&lease).Error; err != nil {
+		log.WithFields(h.sign).Warningf("DeclineHandler the declined address is not held by the client, ignore it")
+		return
+	}
+	addr := net.ParseIP(lease.AssignedAddr)
+
+	if err := h.whereClient(object.Db.Unscoped()).Where("assigned_addr = ?", lease.AssignedAddr).Delete(&models.Leases{}).Error; err != nil {
+		log.WithFields(h.sign).Warningf("DeclineHandler release address %s", err.Error())
+	}
+
+	h.recordConflict(addr, models.ConflictReasonDecline)
+}
+
+// 释放为客户端保留但是还没有确认的地址
+func (h *Handler) releaseOffer() {
+	if err := h.whereClient(object.Db.Unscoped()).Where("state = ?", models.LeaseStateOffered).Delete(&models.Leases{}).Error; err != nil {
+		log.WithFields(h.sign).Warningf("Release offered address %s", err.Error())
+	}
 }
 
 func (h *Handler) withReleaseAddress(handlerName string) {
 	var leases models.Leases
-	clientHWAddr := h.msg.ClientHWAddr.String()
-	if err := object.Db.Unscoped().Where("client_hw_addr = ?", clientHWAddr).Delete(&leases).Error; err != nil {
+	if err := h.whereClient(object.Db.Unscoped()).Delete(&leases).Error; err != nil {
 		log.WithFields(h.sign).Warningf("%s release address %s", handlerName, err.Error())
 	}
 }
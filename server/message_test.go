@@ -0,0 +1,201 @@
+package server
+
+import (
+	"dhcp/models"
+	"dhcp/models/dbtest"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRelayBindIP(t *testing.T) {
+	otherLease := models.Leases{
+		ClientHWAddr: "00:50:56:11:22:33",
+		AssignedAddr: "10.1.1.20",
+		Subnet:       "test",
+		State:        models.LeaseStateBound,
+		Expires:      time.Now().Add(time.Hour),
+	}
+	expiredLease := otherLease
+	expiredLease.Expires = time.Now().Add(-time.Minute)
+	ownLease := otherLease
+	ownLease.ClientHWAddr = testHWAddr.String()
+
+	tests := []struct {
+		name   string
+		tables dbtest.Tables
+		ok     bool
+	}{
+		{"free address", nil, true},
+		{"own lease", dbtest.Tables{"leases": {ownLease}}, true},
+		{"expired lease of another client", dbtest.Tables{"leases": {expiredLease}}, true},
+		{"active lease of another client", dbtest.Tables{"leases": {otherLease}}, false},
+		{"reserved address", dbtest.Tables{"reserves": {models.Reserves{Address: "10.1.1.20"}}}, false},
+	}
+	for _, test := range tests {
+		db := openTestDB(t, test.tables)
+		h, _ := newTestHandler(dhcpv4.MessageTypeOffer)
+
+		ip, err := h.relayBindIP("10.1.1.20")
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: relayBindIP() = %s, want error", test.name, ip)
+			}
+			if deletes := db.ExecsOn("DELETE", "leases"); len(deletes) != 0 {
+				t.Errorf("%s: unexpected delete %s", test.name, deletes[0].SQL)
+			}
+			continue
+		}
+		if err != nil || !ip.Equal(net.IP{10, 1, 1, 20}) {
+			t.Errorf("%s: relayBindIP() = %s, %v, want 10.1.1.20", test.name, ip, err)
+		}
+		// 只删除当前客户端其他地址的租约或者已经过期的租约
+		for _, q := range db.ExecsOn("DELETE", "leases") {
+			if !q.Has("client_hw_addr = ?") && !q.Has("assigned_addr = ?") {
+				t.Errorf("%s: unexpected delete %s", test.name, q.SQL)
+			}
+		}
+	}
+}
+
+func TestCheckLeaseTimeRange(t *testing.T) {
+	tests := []struct {
+		leaseTime, min, max string
+		ok                  bool
+	}{
+		{"1h", "", "", true},
+		{"1h", "10m", "2h", true},
+		{"1h", "2h", "2h", true},
+		{"1h", "3h", "2h", false},
+		// 只配置了下限时上限为租约时间
+		{"1h", "30m", "", true},
+		{"1h", "2h", "", false},
+		{"", "2h", "", true},
+		{"1h", "", "10m", true},
+	}
+	for _, test := range tests {
+		err := CheckLeaseTimeRange(test.leaseTime, test.min, test.max)
+		if (err == nil) != test.ok {
+			t.Errorf("CheckLeaseTimeRange(%q, %q, %q) = %v, want ok %v", test.leaseTime, test.min, test.max, err, test.ok)
+		}
+	}
+}
+
+func TestUpdateLeaseInfoHostname(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		stored   string
+		want     string
+	}{
+		{"valid hostname", "web01", "", "web01"},
+		{"hostname with domain", "web01.example.com.", "", "web01.example.com"},
+		{"renewal without hostname", "", "web01", "web01"},
+		// 不合法的主机名会被注入到启动配置模板中, 不保存
+		{"template injection", "x\nkernel evil", "", ""},
+		{"invalid hostname keeps stored", "-bad-", "web01", "web01"},
+	}
+	for _, test := range tests {
+		openTestDB(t, nil)
+		var modifiers []dhcpv4.Modifier
+		if test.hostname != "" {
+			modifiers = append(modifiers, dhcpv4.WithOption(dhcpv4.OptHostName(test.hostname)))
+		}
+		h, _ := newTestHandler(dhcpv4.MessageTypeAck, modifiers...)
+		lease := models.Leases{Hostname: test.stored}
+		if err := h.updateLeaseInfo(&lease); err != nil {
+			t.Fatal(err)
+		}
+		if lease.Hostname != test.want {
+			t.Errorf("%s: hostname %q, want %q", test.name, lease.Hostname, test.want)
+		}
+	}
+}
+
+func TestUpdateLeaseInfoOffer(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		messageType dhcpv4.MessageType
+		lease       models.Leases
+		state       string
+		// 期望的到期时间与当前时间的差值, 0 表示保持不变
+		expiresIn time.Duration
+	}{
+		{"offer new address", dhcpv4.MessageTypeOffer, models.Leases{}, models.LeaseStateOffered, 10 * time.Second},
+		{"offer again before the ack", dhcpv4.MessageTypeOffer, models.Leases{State: models.LeaseStateOffered, Expires: now.Add(time.Second)}, models.LeaseStateOffered, 10 * time.Second},
+		// 已经生效的租约在客户端重新发送 DHCPDISCOVER 时保持不变
+		{"offer to bound client", dhcpv4.MessageTypeOffer, models.Leases{State: models.LeaseStateBound, Expires: now.Add(time.Hour)}, models.LeaseStateBound, 0},
+		{"offer after lease expired", dhcpv4.MessageTypeOffer, models.Leases{State: models.LeaseStateBound, Expires: now.Add(-time.Minute)}, models.LeaseStateOffered, 10 * time.Second},
+		{"ack offered address", dhcpv4.MessageTypeAck, models.Leases{State: models.LeaseStateOffered, Expires: now.Add(time.Second)}, models.LeaseStateBound, time.Hour},
+	}
+	for _, test := range tests {
+		openTestDB(t, nil)
+		h, _ := newTestHandler(test.messageType)
+		h.options.OfferHoldTime = "10s"
+		lease := test.lease
+		if err := h.updateLeaseInfo(&lease); err != nil {
+			t.Fatal(err)
+		}
+
+		if lease.State != test.state {
+			t.Errorf("%s: state %s, want %s", test.name, lease.State, test.state)
+		}
+		if test.expiresIn == 0 {
+			if !lease.Expires.Equal(test.lease.Expires) {
+				t.Errorf("%s: expires changed to %s", test.name, lease.Expires)
+			}
+			continue
+		}
+		if d := time.Until(lease.Expires) - test.expiresIn; d > time.Second || d < -time.Second {
+			t.Errorf("%s: expires in %s, want %s", test.name, time.Until(lease.Expires), test.expiresIn)
+		}
+	}
+}
+
+// 其他客户端的 DHCPOFFER 在保留时间内不能分配, 超时未确认之后可以重新分配
+func TestOfferExpiry(t *testing.T) {
+	offer := models.Leases{
+		ClientHWAddr: "00:50:56:11:22:33",
+		AssignedAddr: "10.1.1.20",
+		Subnet:       "test",
+		State:        models.LeaseStateOffered,
+		Expires:      time.Now().Add(10 * time.Second),
+	}
+	expired := offer
+	expired.Expires = time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name  string
+		lease models.Leases
+		taken bool
+	}{
+		{"offer held for another client", offer, true},
+		{"offer expired", expired, false},
+	}
+	for _, test := range tests {
+		db := openTestDB(t, dbtest.Tables{"leases": {test.lease}})
+		h, _ := newTestHandler(dhcpv4.MessageTypeOffer)
+
+		if taken := h.checkLeases("10.1.1.20"); taken != test.taken {
+			t.Errorf("%s: checkLeases() = %v, want %v", test.name, taken, test.taken)
+		}
+		inserts := db.ExecsOn("INSERT", "leases")
+		if test.taken != (len(inserts) == 0) {
+			t.Errorf("%s: %d leases inserted", test.name, len(inserts))
+		}
+	}
+}
+
+// 客户端选择了其他服务器时释放为其保留的地址
+func TestReleaseOffer(t *testing.T) {
+	db := openTestDB(t, nil)
+	h, _ := newTestHandler(dhcpv4.MessageTypeAck)
+	h.releaseOffer()
+
+	deletes := db.ExecsOn("DELETE", "leases")
+	if len(deletes) != 1 || !deletes[0].Has("client_hw_addr = ?") || !deletes[0].Has("state = ?") || deletes[0].Arg(1) != models.LeaseStateOffered {
+		t.Errorf("deletes %v, want delete of the offered lease", deletes)
+	}
+}
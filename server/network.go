@@ -0,0 +1,153 @@
+package server
+
+import (
+	"dhcp/models"
+	"encoding/binary"
+	"fmt"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// 微软客户端使用的无类别静态路由选项, 编码与 option 121 相同
+const optionMSClasslessRoutes = dhcpv4.GenericOptionCode(249)
+
+// 解析无类别静态路由, 格式为 目的网络:网关, 多条路由以逗号(,)分隔
+func parseClasslessRoutes(s string) ([]*dhcpv4.Route, error) {
+	var routes []*dhcpv4.Route
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		fields := strings.Split(item, ":")
+		if len(fields) != 2 {
+			return nil, errors.New(fmt.Sprintf("invalid classless route %s", item))
+		}
+		dest, err := parseCIDR(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		router := net.ParseIP(fields[1]).To4()
+		if router == nil {
+			return nil, errors.New(fmt.Sprintf("invalid classless route gateway %s", fields[1]))
+		}
+		routes = append(routes, &dhcpv4.Route{Dest: dest, Router: router})
+	}
+	return routes, nil
+}
+
+// 解析以逗号(,)分隔的域名列表
+func parseDomains(s string) []string {
+	var domains []string
+	for _, domain := range strings.Split(s, ",") {
+		if domain = strings.TrimSuffix(strings.TrimSpace(domain), "."); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// 按照 RFC 1035 4.1.4 编码域名搜索列表(option 119, RFC 3397)
+// 与之前的域名相同的后缀以指针代替
+func encodeDomainSearch(domains []string) []byte {
+	var data []byte
+	offsets := make(map[string]int)
+	for _, domain := range domains {
+		labels := strings.Split(strings.ToLower(domain), ".")
+		pointer := false
+		for i := range labels {
+			suffix := strings.Join(labels[i:], ".")
+			if offset, ok := offsets[suffix]; ok {
+				data = append(data, 0xc0|byte(offset>>8), byte(offset))
+				pointer = true
+				break
+			}
+			// 指针只有 14 位
+			if len(data) < 0x4000 {
+				offsets[suffix] = len(data)
+			}
+			data = append(data, byte(len(labels[i])))
+			data = append(data, labels[i]...)
+		}
+		if !pointer {
+			data = append(data, 0)
+		}
+	}
+	return data
+}
+
+// 检查常用网络配置选项是否合法
+func CheckNetworkOptions(options *models.NetworkOptions) error {
+	if options.DomainName != "" {
+		if err := CheckHostname(strings.TrimSuffix(options.DomainName, ".")); err != nil {
+			return errors.New(fmt.Sprintf("invalid domain name %s", options.DomainName))
+		}
+	}
+	if options.DomainSearch != "" {
+		for _, domain := range parseDomains(options.DomainSearch) {
+			if err := CheckHostname(domain); err != nil {
+				return errors.New(fmt.Sprintf("invalid search domain %s", domain))
+			}
+		}
+	}
+	if options.NTPServers != "" {
+		for _, ip := range parse(options.NTPServers) {
+			if ip.To4() == nil {
+				return errors.New("invalid ntp server address")
+			}
+		}
+	}
+	if options.BroadcastAddr != "" && net.ParseIP(options.BroadcastAddr).To4() == nil {
+		return errors.New("invalid broadcast address")
+	}
+	if options.MTU != "" {
+		// RFC 2132 规定的最小 MTU 为 68
+		if mtu, err := strconv.ParseUint(options.MTU, 10, 16); err != nil || mtu < 68 {
+			return errors.New(fmt.Sprintf("invalid mtu %s", options.MTU))
+		}
+	}
+	if options.ClasslessRoutes != "" {
+		if _, err := parseClasslessRoutes(options.ClasslessRoutes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 设置地址池的常用网络配置选项
+func (h *Handler) withNetworkOptions(network *net.IPNet) {
+	options := h.subnet.NetworkOptions
+
+	if options.DomainName != "" {
+		h.msg.UpdateOption(dhcpv4.OptDomainName(strings.TrimSuffix(options.DomainName, ".")))
+	}
+	if domains := parseDomains(options.DomainSearch); len(domains) > 0 {
+		h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionDNSDomainSearchList, encodeDomainSearch(domains)))
+	}
+	if ntp := parse(options.NTPServers); len(ntp) > 0 {
+		h.msg.UpdateOption(dhcpv4.OptNTPServers(ntp...))
+	}
+
+	broadcast := net.ParseIP(options.BroadcastAddr).To4()
+	if broadcast == nil {
+		broadcast = uint32ToIP(ipToUint32(network.IP) | ^binary.BigEndian.Uint32(network.Mask))
+	}
+	h.msg.UpdateOption(dhcpv4.OptBroadcastAddress(broadcast))
+
+	if mtu, err := strconv.ParseUint(options.MTU, 10, 16); err == nil {
+		h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionInterfaceMTU, dhcpv4.Uint16(mtu).ToBytes()))
+	}
+
+	if options.ClasslessRoutes != "" {
+		routes, err := parseClasslessRoutes(options.ClasslessRoutes)
+		if err != nil {
+			log.WithFields(h.sign).Errorf("Error parsing classless routes %s", err.Error())
+			return
+		}
+		h.msg.UpdateOption(dhcpv4.OptClasslessStaticRoute(routes...))
+		if h.req.ParameterRequestList().Has(optionMSClasslessRoutes) {
+			h.msg.UpdateOption(dhcpv4.OptGeneric(optionMSClasslessRoutes, dhcpv4.Routes(routes).ToBytes()))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"testing"
+)
+
+func TestEncodeDomainSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains []string
+		want    []byte
+	}{
+		{
+			name:    "single domain",
+			domains: []string{"example.com"},
+			want:    []byte("\x07example\x03com\x00"),
+		},
+		{
+			// RFC 3397 第 3 节的示例, 第二个域名的 apple.com 以指针(偏移 4)代替
+			name:    "rfc 3397 example",
+			domains: []string{"eng.apple.com", "marketing.apple.com"},
+			want:    []byte("\x03eng\x05apple\x03com\x00\x09marketing\xc0\x04"),
+		},
+		{
+			// 整个域名与之前的域名相同时只有一个指针
+			name:    "duplicate domain",
+			domains: []string{"apple.com", "apple.com"},
+			want:    []byte("\x05apple\x03com\x00\xc0\x00"),
+		},
+		{
+			// 指针指向之前域名中间的后缀 com(偏移 6)
+			name:    "pointer to inner suffix",
+			domains: []string{"apple.com", "example.com"},
+			want:    []byte("\x05apple\x03com\x00\x07example\xc0\x06"),
+		},
+		{
+			// 域名不区分大小写
+			name:    "case insensitive",
+			domains: []string{"Example.COM", "www.example.com"},
+			want:    []byte("\x07example\x03com\x00\x03www\xc0\x00"),
+		},
+		{
+			name:    "empty list",
+			domains: nil,
+			want:    nil,
+		},
+	}
+	for _, test := range tests {
+		if got := encodeDomainSearch(test.domains); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: encodeDomainSearch(%q) = %x, want %x", test.name, test.domains, got, test.want)
+		}
+	}
+}
+
+func TestParseDomains(t *testing.T) {
+	got := parseDomains(" example.com., ,corp.example.com ")
+	if len(got) != 2 || got[0] != "example.com" || got[1] != "corp.example.com" {
+		t.Errorf("parseDomains() = %q", got)
+	}
+}
+
+func TestClasslessRoutesEncoding(t *testing.T) {
+	tests := []struct {
+		routes string
+		want   []byte
+	}{
+		// 默认路由, 目的网络没有有效字节
+		{"0.0.0.0/0:10.0.0.1", []byte{0, 10, 0, 0, 1}},
+		// 主机路由, 目的网络 4 个字节
+		{"10.1.2.3/32:10.0.0.1", []byte{32, 10, 1, 2, 3, 10, 0, 0, 1}},
+		{"192.168.1.0/24:10.0.0.1", []byte{24, 192, 168, 1, 10, 0, 0, 1}},
+		// 前缀长度不是 8 的整数倍时向上取整
+		{"10.128.0.0/9:10.0.0.1", []byte{9, 10, 128, 10, 0, 0, 1}},
+		{"172.16.0.0/12:10.0.0.1", []byte{12, 172, 16, 10, 0, 0, 1}},
+		{
+			"0.0.0.0/0:10.0.0.1, 10.1.2.3/32:10.0.0.254",
+			[]byte{0, 10, 0, 0, 1, 32, 10, 1, 2, 3, 10, 0, 0, 254},
+		},
+	}
+	for _, test := range tests {
+		routes, err := parseClasslessRoutes(test.routes)
+		if err != nil {
+			t.Errorf("parseClasslessRoutes(%q) error %s", test.routes, err)
+			continue
+		}
+		if got := dhcpv4.Routes(routes).ToBytes(); !bytes.Equal(got, test.want) {
+			t.Errorf("classless routes %q encoded %v, want %v", test.routes, got, test.want)
+		}
+	}
+}
+
+func TestParseClasslessRoutesMalformed(t *testing.T) {
+	tests := []string{
+		"",
+		"10.0.0.0/8",
+		"10.0.0.0/8:",
+		"10.0.0.0/33:10.0.0.1",
+		"10.0.0.0:10.0.0.1:10.0.0.2",
+		"10.0.0.0/8:fe80::1",
+	}
+	for _, routes := range tests {
+		if _, err := parseClasslessRoutes(routes); err == nil {
+			t.Errorf("parseClasslessRoutes(%q) expected error", routes)
+		}
+	}
+}
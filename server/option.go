@@ -0,0 +1,168 @@
+package server
+
+import (
+	"dhcp/models"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// 不允许通过自定义选项设置的选项, 这些选项由服务器根据协议生成
+// 租约时间, 服务器标识和 T1/T2 必须与数据库中记录的租约一致
+var reservedOptions = map[uint8]bool{
+	uint8(dhcpv4.OptionPad):                   true,
+	uint8(dhcpv4.OptionIPAddressLeaseTime):    true,
+	uint8(dhcpv4.OptionOptionOverload):        true,
+	uint8(dhcpv4.OptionDHCPMessageType):       true,
+	uint8(dhcpv4.OptionServerIdentifier):      true,
+	uint8(dhcpv4.OptionRenewTimeValue):        true,
+	uint8(dhcpv4.OptionRebindingTimeValue):    true,
+	uint8(dhcpv4.OptionParameterRequestList):  true,
+	uint8(dhcpv4.OptionRelayAgentInformation): true,
+	uint8(dhcpv4.OptionEnd):                   true,
+}
+
+// 按照选项的值类型编码选项
+func encodeOptionValue(optionType, value string) ([]byte, error) {
+	switch optionType {
+	case models.OptionTypeIP, models.OptionTypeIPList:
+		var data []byte
+		items := strings.Split(value, ",")
+		if optionType == models.OptionTypeIP && len(items) != 1 {
+			return nil, errors.New("option type ip accepts a single address")
+		}
+		for _, item := range items {
+			ip := net.ParseIP(strings.TrimSpace(item)).To4()
+			if ip == nil {
+				return nil, errors.New(fmt.Sprintf("invalid ip address %s", item))
+			}
+			data = append(data, ip...)
+		}
+		return data, nil
+	case models.OptionTypeString:
+		if value == "" {
+			return nil, errors.New("empty string value")
+		}
+		return []byte(value), nil
+	case models.OptionTypeUint8, models.OptionTypeUint16, models.OptionTypeUint32:
+		size := map[string]int{models.OptionTypeUint8: 8, models.OptionTypeUint16: 16, models.OptionTypeUint32: 32}[optionType]
+		n, err := strconv.ParseUint(value, 10, size)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint32(data, uint32(n))
+		return data[4-size/8:], nil
+	case models.OptionTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case models.OptionTypeHex:
+		data, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, errors.New("empty hex value")
+		}
+		return data, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown option type %s", optionType))
+	}
+}
+
+// 检查自定义选项是否合法
+func CheckCustomOption(option *models.CustomOption) error {
+	switch option.Scope {
+	case models.OptionScopeGlobal:
+		if option.Target != "" {
+			return errors.New("global option does not accept a target")
+		}
+	case models.OptionScopeSubnet, models.OptionScopeBinding, models.OptionScopeClass:
+		if option.Target == "" {
+			return errors.New(fmt.Sprintf("%s option requires a target", option.Scope))
+		}
+	default:
+		return errors.New("scope in (global|subnet|class|binding)")
+	}
+
+	// 绑定的目标统一为 net.HardwareAddr.String() 的格式或者小写的 client identifier, 与查询时的格式一致
+	if option.Scope == models.OptionScopeBinding {
+		if hw, err := net.ParseMAC(option.Target); err == nil {
+			option.Target = hw.String()
+		} else if _, err := hex.DecodeString(option.Target); err == nil {
+			option.Target = strings.ToLower(option.Target)
+		} else {
+			return errors.New("binding option target must be a mac address or client identifier")
+		}
+	}
+
+	if reservedOptions[option.Code] {
+		return errors.New(fmt.Sprintf("option %d can not be customized", option.Code))
+	}
+
+	data, err := encodeOptionValue(option.Type, option.Value)
+	if err != nil {
+		return err
+	}
+	if len(data) > 255 {
+		return errors.New("option value is too long")
+	}
+	return nil
+}
+
+// 查询适用于当前客户端的自定义选项, 同一个选项只保留优先级最高的作用范围
+func (h *Handler) queryCustomOptions() map[uint8]models.CustomOption {
+	var customOptions []models.CustomOption
+	targets := []string{h.req.ClientHWAddr.String()}
+	if h.clientID != "" {
+		targets = append(targets, h.clientID)
+	}
+	db := object.Db.Where("scope = ?", models.OptionScopeGlobal).
+		Or("scope = ? and target = ?", models.OptionScopeSubnet, h.subnet.Name).
+		Or("scope = ? and target in ?", models.OptionScopeBinding, targets)
+	if h.class != nil {
+		db = db.Or("scope = ? and target = ?", models.OptionScopeClass, h.class.Name)
+	}
+	if err := db.Find(&customOptions).Error; err != nil {
+		log.WithFields(h.sign).Errorf("Error query custom options %s", err.Error())
+		return nil
+	}
+
+	priority := map[string]int{models.OptionScopeGlobal: 0, models.OptionScopeSubnet: 1, models.OptionScopeClass: 2, models.OptionScopeBinding: 3}
+	selected := make(map[uint8]models.CustomOption)
+	for _, option := range customOptions {
+		if current, ok := selected[option.Code]; ok && priority[current.Scope] >= priority[option.Scope] {
+			continue
+		}
+		selected[option.Code] = option
+	}
+	return selected
+}
+
+// 设置自定义选项, 客户端发送了参数请求列表(option 55)时只发送列表中包含的选项
+func (h *Handler) withCustomOptions() {
+	requested := h.req.ParameterRequestList()
+	for code, option := range h.queryCustomOptions() {
+		if len(requested) > 0 && !requested.Has(dhcpv4.GenericOptionCode(code)) {
+			continue
+		}
+		data, err := encodeOptionValue(option.Type, option.Value)
+		if err != nil {
+			log.WithFields(h.sign).Errorf("Error encode custom option %d %s", code, err.Error())
+			continue
+		}
+		h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(code), data))
+	}
+}
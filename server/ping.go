@@ -0,0 +1,102 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// 没有配置 PingTimeout 时探测地址的超时时间
+const defaultPingTimeout = 500 * time.Millisecond
+
+// 通过 ICMP echo 检查地址是否已被使用
+func pingCheck(ip net.IP, timeout time.Duration) (bool, error) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	id := rand.Intn(0xffff)
+	seq := rand.Intn(0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("dhcpd conflict detection")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := conn.WriteTo(data, &net.IPAddr{IP: ip}); err != nil {
+		return false, err
+	}
+
+	// 原始套接字会收到所有的 ICMP 报文, 需要根据地址, id 和 seq 过滤
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				return false, nil
+			}
+			return false, err
+		}
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(ip) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == id && echo.Seq == seq {
+			return true, nil
+		}
+	}
+}
+
+// 返回与地址直连的网络接口, 指定了监听接口时只检查监听接口
+func attachedInterface(ip net.IP) (*net.Interface, error) {
+	var ifaces []net.Interface
+	if serverConfig != nil && serverConfig.IFName != "" {
+		iface, err := net.InterfaceByName(serverConfig.IFName)
+		if err != nil {
+			return nil, err
+		}
+		ifaces = append(ifaces, *iface)
+	} else {
+		var err error
+		if ifaces, err = net.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.Contains(ip) {
+				return &ifaces[i], nil
+			}
+		}
+	}
+	return nil, errors.New("no interface attached to " + ip.String())
+}
+
+// 检查地址是否已被使用, 直连的网段先发送 ARP 探测, 然后发送 ICMP echo
+func addressInUse(ip net.IP, timeout time.Duration) (bool, error) {
+	if iface, err := attachedInterface(ip); err == nil {
+		if inUse, err := arpProbe(iface, ip, timeout); err != nil || inUse {
+			return inUse, err
+		}
+	}
+	return pingCheck(ip, timeout)
+}
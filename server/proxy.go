@@ -0,0 +1,97 @@
+package server
+
+import (
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+	log "github.com/sirupsen/logrus"
+	"net"
+)
+
+// 服务器运行模式
+const (
+	ModeDHCP  = "dhcp"
+	ModeProxy = "proxy"
+)
+
+// ProxyDHCP 模式下客户端没有要求立即启动时使用的 PXE_DISCOVERY_CONTROL, 直接下载 DHCPOFFER 中的启动文件
+var proxyVendorOptions = []byte{pxeDiscoveryControl, 1, 0x08, pxeEnd}
+
+// ProxyDHCP 模式(PXE 2.1 规范 2.2.3), 地址由网络中的其他 DHCP 服务器分配, 此服务器只回应 PXE 客户端
+// 1. DHCPDISCOVER: 回应不包含地址(yiaddr 为 0)的 DHCPOFFER, 只包含启动信息
+// 2. 发送到 4011 端口的 DHCPREQUEST: 回应包含启动文件的 DHCPACK
+// 3. 包含启动项(option 43 子选项 71)的 DHCPREQUEST: 按照启动菜单项回应
+func proxyHandler(port int) server4.Handler {
+	return func(conn net.PacketConn, peer net.Addr, msg *dhcpv4.DHCPv4) {
+		sign := requestFields(msg)
+		sign["port"] = port
+
+		if !isPXEClient(msg) {
+			log.WithFields(sign).Debugf("Not a PXE client, ignore it")
+			return
+		}
+
+		class := matchClientClass(msg, sign)
+		if class != nil {
+			sign["client_class"] = class.Name
+		}
+		if acl(msg, class, sign) {
+			return
+		}
+
+		reply, err := dhcpv4.NewReplyFromRequest(msg)
+		if err != nil {
+			log.WithFields(sign).Errorf("New reply from request %s", err.Error())
+			return
+		}
+
+		switch msg.MessageType() {
+		case dhcpv4.MessageTypeDiscover:
+			if port == pxeBootServerPort {
+				return
+			}
+			NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeOffer, class, sign).ProxyHandler()
+		case dhcpv4.MessageTypeRequest:
+			if _, _, ok := parseBootItem(msg); ok {
+				NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeAck, class, sign).BootServerHandler()
+				return
+			}
+			// 发送到 67 端口的 DHCPREQUEST 由分配地址的 DHCP 服务器处理
+			if port != pxeBootServerPort {
+				return
+			}
+			NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeAck, class, sign).ProxyHandler()
+		default:
+			log.WithFields(sign).Debugf("Ignore %s in proxy mode", msg.MessageType())
+		}
+	}
+}
+
+// 回应只包含启动信息的 DHCPOFFER 或者 DHCPACK, 不分配地址也不记录租约
+func (h *Handler) ProxyHandler() {
+	if h.subnet == nil {
+		log.WithFields(h.sign).Warningf("No subnet matched the client request")
+		return
+	}
+	h.sign["subnet"] = h.subnet.Name
+
+	h.msg.UpdateOption(dhcpv4.OptMessageType(h.messageType))
+	h.msg.UpdateOption(dhcpv4.OptServerIdentifier(net.ParseIP(h.subnet.ServerIP)))
+	h.msg.BootFileName, h.msg.ServerIPAddr = h.bootConfig()
+	h.msg.UpdateOption(dhcpv4.OptClassIdentifier(pxeClientClass))
+
+	// PXE 客户端只接受包含 option 43 的 ProxyDHCP 响应
+	vendorOptions, err := h.encodePXEOptions()
+	if err != nil {
+		log.WithFields(h.sign).Errorf("Error encode pxe options %s", err.Error())
+	}
+	if vendorOptions == nil {
+		vendorOptions = proxyVendorOptions
+	}
+	h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, vendorOptions))
+	h.msg.YourIPAddr = net.IPv4zero
+	h.msg.ClientIPAddr = h.req.ClientIPAddr
+
+	log.WithFields(h.sign).Debug(h.msg)
+
+	h.writeReply()
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"dhcp/models"
+	"encoding/binary"
+	"fmt"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PXE 客户端和 UEFI HTTP 启动客户端的 vendor class identifier(option 60) 前缀
+const (
+	pxeClientClass  = "PXEClient"
+	httpClientClass = "HTTPClient"
+)
+
+// option 43 中的 PXE 子选项(PXE 2.1 规范 2.2.6)
+const (
+	pxeDiscoveryControl = 6
+	pxeBootServers      = 8
+	pxeBootMenu         = 9
+	pxeMenuPrompt       = 10
+	pxeBootItem         = 71
+	pxeEnd              = 255
+)
+
+// PXE 启动服务器端口, 客户端选择启动菜单项之后向此端口请求启动文件, ProxyDHCP 模式下客户端获取地址之后也向此端口请求启动文件
+const pxeBootServerPort = 4011
+
+// 客户端是否是 PXE 客户端
+func isPXEClient(req *dhcpv4.DHCPv4) bool {
+	return strings.HasPrefix(req.ClassIdentifier(), pxeClientClass)
+}
+
+// 客户端是否是 UEFI HTTP 启动客户端(UEFI 规范 24.7)
+func isHTTPClient(req *dhcpv4.DHCPv4) bool {
+	return strings.HasPrefix(req.ClassIdentifier(), httpClientClass)
+}
+
+// 解析 option 43 中的子选项
+func parseVendorSubOptions(data []byte) map[uint8][]byte {
+	subOptions := make(map[uint8][]byte)
+	for len(data) >= 2 {
+		code, length := data[0], int(data[1])
+		if code == pxeEnd || len(data) < 2+length {
+			break
+		}
+		subOptions[code] = data[2 : 2+length]
+		data = data[2+length:]
+	}
+	return subOptions
+}
+
+// 客户端向启动服务器发送的启动项(option 43 子选项 71), 返回启动服务器类型和层
+func parseBootItem(req *dhcpv4.DHCPv4) (uint16, uint16, bool) {
+	if !isPXEClient(req) {
+		return 0, 0, false
+	}
+	item := parseVendorSubOptions(req.Options.Get(dhcpv4.OptionVendorSpecificInformation))[pxeBootItem]
+	if len(item) != 4 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint16(item[:2]), binary.BigEndian.Uint16(item[2:]), true
+}
+
+// 查询地址池的启动菜单项, 地址池没有配置菜单项时使用全局的菜单项
+func (h *Handler) queryPXEMenu() []models.PXEMenuItem {
+	var items []models.PXEMenuItem
+	for _, subnet := range []string{h.subnet.Name, ""} {
+		if err := object.Db.Where("subnet = ?", subnet).Order("type").Find(&items).Error; err != nil {
+			log.WithFields(h.sign).Errorf("Error query pxe menu %s", err.Error())
+			return nil
+		}
+		if len(items) > 0 {
+			return items
+		}
+	}
+	return nil
+}
+
+// 启动菜单项使用的启动服务器地址
+func (h *Handler) pxeServer(item *models.PXEMenuItem) net.IP {
+	if ip := net.ParseIP(item.Server).To4(); ip != nil {
+		return ip
+	}
+	return net.ParseIP(h.subnet.ServerIP).To4()
+}
+
+// 编码启动服务器(子选项 8)和启动菜单(子选项 9), server 返回菜单项使用的启动服务器地址
+func encodePXEMenu(items []models.PXEMenuItem, server func(item *models.PXEMenuItem) net.IP) ([]byte, []byte) {
+	var servers, menu []byte
+	for i := range items {
+		item := &items[i]
+		// 本地启动不需要启动服务器
+		if item.Type != 0 {
+			servers = append(servers, byte(item.Type>>8), byte(item.Type), 1)
+			servers = append(servers, server(item)...)
+		}
+		menu = append(menu, byte(item.Type>>8), byte(item.Type), byte(len(item.Description)))
+		menu = append(menu, item.Description...)
+	}
+	return servers, menu
+}
+
+// 编码 PXE 子选项, 没有任何 PXE 配置时返回 nil, 子选项的长度超过 255 个字节时返回错误
+func (h *Handler) encodePXEOptions() ([]byte, error) {
+	var data []byte
+	appendSubOption := func(code uint8, value []byte) error {
+		if len(value) > 255 {
+			return errors.New(fmt.Sprintf("pxe sub-option %d is too long (%d bytes)", code, len(value)))
+		}
+		data = append(data, code, byte(len(value)))
+		data = append(data, value...)
+		return nil
+	}
+
+	if control, err := strconv.ParseUint(h.subnet.PXEDiscoveryControl, 10, 8); err == nil {
+		if err := appendSubOption(pxeDiscoveryControl, []byte{byte(control)}); err != nil {
+			return nil, err
+		}
+	}
+
+	items := h.queryPXEMenu()
+	if len(items) > 0 {
+		servers, menu := encodePXEMenu(items, h.pxeServer)
+		if len(servers) > 0 {
+			if err := appendSubOption(pxeBootServers, servers); err != nil {
+				return nil, err
+			}
+		}
+		if err := appendSubOption(pxeBootMenu, menu); err != nil {
+			return nil, err
+		}
+
+		if h.subnet.PXEMenuPrompt != "" {
+			timeout, err := strconv.ParseUint(h.subnet.PXEMenuTimeout, 10, 8)
+			if err != nil {
+				timeout = 10
+			}
+			if err := appendSubOption(pxeMenuPrompt, append([]byte{byte(timeout)}, h.subnet.PXEMenuPrompt...)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return append(data, pxeEnd), nil
+}
+
+// PXE 客户端要求服务器回应 option 60, 配置了 PXE 子选项时通过 option 43 发送
+// UEFI HTTP 启动客户端要求服务器回应 option 60 为 HTTPClient
+func (h *Handler) withPXEOptions() {
+	if isHTTPClient(h.req) {
+		h.msg.UpdateOption(dhcpv4.OptClassIdentifier(httpClientClass))
+		return
+	}
+	if !isPXEClient(h.req) {
+		return
+	}
+	h.msg.UpdateOption(dhcpv4.OptClassIdentifier(pxeClientClass))
+	data, err := h.encodePXEOptions()
+	if err != nil {
+		log.WithFields(h.sign).Errorf("Error encode pxe options %s", err.Error())
+		return
+	}
+	if data != nil {
+		h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, data))
+	}
+}
+
+// 响应 PXE 客户端的启动服务器发现请求(PXE 2.1 规范 2.2.5), 返回客户端选择的启动项的启动文件
+// 请求中 option 43 的子选项 71 为客户端选择的启动服务器类型, 回应中原样返回
+func (h *Handler) BootServerHandler() {
+	itemType, layer, ok := parseBootItem(h.req)
+	if !ok || h.subnet == nil {
+		return
+	}
+	h.sign["pxe_boot_item"] = itemType
+
+	var item *models.PXEMenuItem
+	items := h.queryPXEMenu()
+	for i := range items {
+		if items[i].Type == itemType {
+			item = &items[i]
+			break
+		}
+	}
+	if item == nil || item.BootFileName == "" {
+		log.WithFields(h.sign).Debugf("Unknown pxe boot item %d, ignore it", itemType)
+		return
+	}
+
+	// 不支持 PXE 安全认证, 清除层的最高位
+	layer &= 0x7fff
+	h.msg.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+	h.msg.UpdateOption(dhcpv4.OptServerIdentifier(net.ParseIP(h.subnet.ServerIP)))
+	h.msg.UpdateOption(dhcpv4.OptClassIdentifier(pxeClientClass))
+	h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, []byte{
+		pxeBootItem, 4, byte(itemType >> 8), byte(itemType), byte(layer >> 8), byte(layer), pxeEnd,
+	}))
+	h.msg.BootFileName = item.BootFileName
+	h.msg.ServerIPAddr = h.pxeServer(item)
+	h.msg.ClientIPAddr = h.req.ClientIPAddr
+
+	log.WithFields(h.sign).Debug(h.msg)
+
+	h.writeReply()
+}
+
+// 在 4011 端口接收 PXE 客户端的启动服务器请求
+// DHCP 模式下只有配置了启动菜单时才需要此端口, 端口无法使用时只记录错误, 不影响分配地址
+func serveBootServer(d *DHCPDConfig, h server4.Handler) {
+	laddr := net.UDPAddr{
+		IP:   net.ParseIP(d.Listen),
+		Port: pxeBootServerPort,
+	}
+	server, err := server4.NewServer(d.IFName, &laddr, h)
+	if err == nil {
+		err = server.Serve()
+	}
+	if err == nil {
+		return
+	}
+	// ProxyDHCP 模式下客户端必须通过此端口获取启动文件
+	if d.Mode == ModeProxy {
+		panic(err)
+	}
+	log.Errorf("Error serve pxe boot server on port %d %s", pxeBootServerPort, err.Error())
+}
+
+// DHCP 模式下 4011 端口只处理包含启动项的 DHCPREQUEST
+func bootServerHandler(conn net.PacketConn, peer net.Addr, msg *dhcpv4.DHCPv4) {
+	if _, _, ok := parseBootItem(msg); !ok || msg.MessageType() != dhcpv4.MessageTypeRequest {
+		return
+	}
+	handler(conn, peer, msg)
+}
+
+// 检查 PXE 子选项配置是否合法
+func CheckPXEOptions(options *models.PXEOptions) error {
+	for _, field := range []string{options.PXEDiscoveryControl, options.PXEMenuTimeout} {
+		if field == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(field, 10, 8); err != nil {
+			return errors.New(fmt.Sprintf("invalid pxe discovery control or menu timeout %s", field))
+		}
+	}
+	if len(options.PXEMenuPrompt) > 254 {
+		return errors.New("pxe menu prompt is too long")
+	}
+	return nil
+}
+
+// 检查启动菜单项是否合法
+func CheckPXEMenuItem(item *models.PXEMenuItem) error {
+	// 菜单项在启动菜单(子选项 9)中占用 3 个字节加上描述的长度, 子选项最长 255 个字节
+	if item.Description == "" || len(item.Description) > 252 {
+		return errors.New("invalid pxe menu description")
+	}
+	if item.Server != "" && net.ParseIP(item.Server).To4() == nil {
+		return errors.New("invalid pxe boot server address")
+	}
+	if item.Type != 0 && item.BootFileName == "" {
+		return errors.New("pxe menu item requires a boot file name")
+	}
+	return nil
+}
+
+// 检查地址池的全部启动菜单项, 启动服务器(子选项 8)和启动菜单(子选项 9)都不能超过 255 个字节
+func CheckPXEMenu(items []models.PXEMenuItem) error {
+	servers, menu := encodePXEMenu(items, func(*models.PXEMenuItem) net.IP { return net.IPv4zero.To4() })
+	if len(servers) > 255 {
+		return errors.New(fmt.Sprintf("too many pxe boot servers, %d bytes exceeds 255", len(servers)))
+	}
+	if len(menu) > 255 {
+		return errors.New(fmt.Sprintf("pxe menu is too long, %d bytes exceeds 255", len(menu)))
+	}
+	return nil
+}
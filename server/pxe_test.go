@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/models"
+	"dhcp/models/dbtest"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"strings"
+	"testing"
+)
+
+func TestEncodePXEOptions(t *testing.T) {
+	local := models.PXEMenuItem{Type: 0, Description: "Local"}
+	linux := models.PXEMenuItem{Type: 1, Description: "Linux", BootFileName: "pxelinux.0", Server: "10.1.1.2"}
+	windows := models.PXEMenuItem{Type: 2, Description: "Win", BootFileName: "wdsnbp.com"}
+
+	tests := []struct {
+		name    string
+		subnet  models.PXEOptions
+		items   []interface{}
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "no pxe options",
+			want: nil,
+		},
+		{
+			name:   "discovery control only",
+			subnet: models.PXEOptions{PXEDiscoveryControl: "3"},
+			want:   []byte{6, 1, 3, 255},
+		},
+		{
+			name:   "menu with prompt",
+			subnet: models.PXEOptions{PXEDiscoveryControl: "3", PXEMenuPrompt: "Boot", PXEMenuTimeout: "5"},
+			items:  []interface{}{local, linux, windows},
+			want: []byte{
+				6, 1, 3,
+				// 启动服务器: 类型 1 使用菜单项的服务器, 类型 2 使用地址池的 ServerIP, 本地启动没有启动服务器
+				8, 14, 0, 1, 1, 10, 1, 1, 2, 0, 2, 1, 10, 1, 1, 1,
+				9, 22, 0, 0, 5, 'L', 'o', 'c', 'a', 'l', 0, 1, 5, 'L', 'i', 'n', 'u', 'x', 0, 2, 3, 'W', 'i', 'n',
+				10, 5, 5, 'B', 'o', 'o', 't',
+				255,
+			},
+		},
+		{
+			name:   "prompt without timeout",
+			subnet: models.PXEOptions{PXEMenuPrompt: "Boot"},
+			items:  []interface{}{local},
+			want: []byte{
+				9, 8, 0, 0, 5, 'L', 'o', 'c', 'a', 'l',
+				10, 5, 10, 'B', 'o', 'o', 't',
+				255,
+			},
+		},
+		{
+			// 启动菜单超过 255 个字节时返回错误, 而不是截断长度
+			name: "menu too long",
+			items: []interface{}{
+				models.PXEMenuItem{Type: 1, Description: strings.Repeat("a", 200)},
+				models.PXEMenuItem{Type: 2, Description: strings.Repeat("b", 200)},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		openTestDB(t, dbtest.Tables{"pxe_menu_items": test.items})
+		h, _ := newTestHandler(dhcpv4.MessageTypeOffer)
+		h.subnet.PXEOptions = test.subnet
+
+		got, err := h.encodePXEOptions()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: encodePXEOptions() = %v, want error", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: encodePXEOptions() error %s", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: encodePXEOptions() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckPXEMenu(t *testing.T) {
+	item := func(itemType uint16, length int) models.PXEMenuItem {
+		return models.PXEMenuItem{Type: itemType, Description: strings.Repeat("a", length)}
+	}
+	tests := []struct {
+		name  string
+		items []models.PXEMenuItem
+		ok    bool
+	}{
+		{"single item of maximum length", []models.PXEMenuItem{item(1, 252)}, true},
+		{"items fit in 255 bytes", []models.PXEMenuItem{item(0, 100), item(1, 149)}, true},
+		{"items exceed 255 bytes", []models.PXEMenuItem{item(0, 100), item(1, 150)}, false},
+	}
+	for _, test := range tests {
+		if err := CheckPXEMenu(test.items); (err == nil) != test.ok {
+			t.Errorf("%s: CheckPXEMenu() = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+// 计算 IPv4 首部校验和
+func ipChecksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i : i+2]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// 构造 IPv4 和 UDP 首部, 通过 AF_PACKET 套接字直接发送到目标硬件地址, 不需要经过 ARP 解析
+// UDP 校验和为 0 表示不计算校验和(RFC 768)
+func sendRawUDP(iface *net.Interface, dstMAC net.HardwareAddr, srcIP, dstIP net.IP, srcPort, dstPort int, payload []byte) error {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, int(htons(unix.ETH_P_IP)))
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	udpLen := 8 + len(payload)
+	packet := make([]byte, 20+udpLen)
+
+	ipHeader := packet[:20]
+	ipHeader[0] = 0x45
+	binary.BigEndian.PutUint16(ipHeader[2:4], uint16(len(packet)))
+	ipHeader[8] = 64
+	ipHeader[9] = unix.IPPROTO_UDP
+	copy(ipHeader[12:16], srcIP.To4())
+	copy(ipHeader[16:20], dstIP.To4())
+	binary.BigEndian.PutUint16(ipHeader[10:12], ipChecksum(ipHeader))
+
+	udpHeader := packet[20:28]
+	binary.BigEndian.PutUint16(udpHeader[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(udpHeader[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint16(udpHeader[4:6], uint16(udpLen))
+	copy(packet[28:], payload)
+
+	to := &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_IP), Ifindex: iface.Index, Halen: uint8(len(dstMAC))}
+	copy(to.Addr[:], dstMAC)
+	return unix.Sendto(fd, packet, 0, to)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"github.com/pkg/errors"
+	"net"
+)
+
+// 非 linux 平台不支持通过原始套接字发送, 响应将被广播
+func sendRawUDP(iface *net.Interface, dstMAC net.HardwareAddr, srcIP, dstIP net.IP, srcPort, dstPort int, payload []byte) error {
+	return errors.New("raw unicast is not supported on this platform")
+}
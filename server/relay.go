@@ -0,0 +1,61 @@
+package server
+
+import (
+	"dhcp/models"
+	"encoding/hex"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"net"
+	"unicode"
+)
+
+// 中继代理信息(option 82)中用于匹配客户端的子选项
+type relayInfo struct {
+	circuitID string
+	remoteID  string
+}
+
+// 请求是否经过中继代理转发(giaddr 不为 0)
+func isRelayed(msg *dhcpv4.DHCPv4) bool {
+	return msg.GatewayIPAddr != nil && !msg.GatewayIPAddr.IsUnspecified()
+}
+
+// 经过中继代理转发的请求, 响应需要单播回中继代理的 67 端口(RFC 2131 4.1)
+func relayAddr(msg *dhcpv4.DHCPv4) net.Addr {
+	return &net.UDPAddr{
+		IP:   msg.GatewayIPAddr,
+		Port: dhcpv4.ServerPort,
+	}
+}
+
+// 可打印的子选项值直接转换为字符串, 否则转换为十六进制字符串
+func relayValue(data []byte) string {
+	for _, b := range data {
+		if b > unicode.MaxASCII || !unicode.IsPrint(rune(b)) {
+			return hex.EncodeToString(data)
+		}
+	}
+	return string(data)
+}
+
+// 解析请求中的中继代理信息(option 82), 不存在时返回 nil
+func parseRelayInfo(msg *dhcpv4.DHCPv4) *relayInfo {
+	options := msg.RelayAgentInfo()
+	if options == nil {
+		return nil
+	}
+	return &relayInfo{
+		circuitID: relayValue(options.Get(dhcpv4.AgentCircuitIDSubOption)),
+		remoteID:  relayValue(options.Get(dhcpv4.AgentRemoteIDSubOption)),
+	}
+}
+
+// 查询与中继代理信息匹配的绑定, 优先匹配同时指定了 remote-id 的绑定
+func queryRelayBinding(relay *relayInfo) (*models.RelayBinding, error) {
+	var bind models.RelayBinding
+	err := object.Db.Where("circuit_id = ? and (remote_id = ? or remote_id = '')", relay.circuitID, relay.remoteID).
+		Order("remote_id desc").First(&bind).Error
+	if err != nil {
+		return nil, err
+	}
+	return &bind, nil
+}
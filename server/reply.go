@@ -0,0 +1,78 @@
+package server
+
+import (
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+)
+
+var broadcastAddr = &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}
+
+// 根据 RFC 2131 4.1 选择响应的目的地址并发送
+// 1. giaddr 不为 0 时发送给中继代理的 67 端口, DHCPNAK 需要设置广播标志
+// 2. DHCPNAK 总是广播
+// 3. ciaddr 不为 0 时单播到 ciaddr(续约, DHCPINFORM)
+// 4. 客户端设置了广播标志或者没有分配地址时广播
+// 5. 其他情况单播到 yiaddr 和 chaddr, 客户端还不能应答 ARP, 需要通过原始套接字发送, 没有打开时广播
+func (h *Handler) writeReply() {
+	// RFC 3046 要求服务器在响应中原样返回中继代理信息(option 82)
+	if relayAgentInfo := h.req.Options.Get(dhcpv4.OptionRelayAgentInformation); relayAgentInfo != nil {
+		h.msg.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionRelayAgentInformation, relayAgentInfo))
+	}
+
+	var peer net.Addr
+	switch {
+	case isRelayed(h.req):
+		if h.messageType == dhcpv4.MessageTypeNak {
+			h.msg.SetBroadcast()
+		}
+		peer = relayAddr(h.req)
+	case h.messageType == dhcpv4.MessageTypeNak:
+		peer = broadcastAddr
+	case h.req.ClientIPAddr != nil && !h.req.ClientIPAddr.IsUnspecified():
+		peer = &net.UDPAddr{IP: h.req.ClientIPAddr, Port: dhcpv4.ClientPort}
+		if udpPeer, ok := h.peer.(*net.UDPAddr); ok && udpPeer.IP.Equal(h.req.ClientIPAddr) {
+			peer = udpPeer
+		}
+	case h.req.IsBroadcast() || h.msg.YourIPAddr == nil || h.msg.YourIPAddr.IsUnspecified():
+		peer = broadcastAddr
+	default:
+		if serverConfig != nil && serverConfig.RawUnicast {
+			err := h.writeRawUnicast()
+			if err == nil {
+				return
+			}
+			log.WithFields(h.sign).Warningf("Error unicast DHCP reply message to %s %s, fallback to broadcast", h.msg.YourIPAddr, err.Error())
+		}
+		peer = broadcastAddr
+	}
+
+	if _, err := h.conn.WriteTo(h.msg.ToBytes(), peer); err != nil {
+		log.WithFields(h.sign).Errorf("Error Write DHCP reply message %s", err.Error())
+	}
+}
+
+// 通过原始套接字将响应直接发送到客户端的硬件地址(chaddr)和分配的地址(yiaddr)
+func (h *Handler) writeRawUnicast() error {
+	var iface *net.Interface
+	var err error
+	if serverConfig.IFName != "" {
+		iface, err = net.InterfaceByName(serverConfig.IFName)
+	} else {
+		iface, err = attachedInterface(h.msg.YourIPAddr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 使用服务器标识(option 54)作为源地址, siaddr 可能是其他的启动服务器
+	if h.subnet == nil {
+		return errors.New("unknown server address")
+	}
+	srcIP := net.ParseIP(h.subnet.ServerIP)
+	if srcIP == nil || srcIP.To4() == nil {
+		return errors.New("unknown server address")
+	}
+	return sendRawUDP(iface, h.msg.ClientHWAddr, srcIP, h.msg.YourIPAddr, dhcpv4.ServerPort, dhcpv4.ClientPort, h.msg.ToBytes())
+}
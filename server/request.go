@@ -0,0 +1,187 @@
+package server
+
+import (
+	"dhcp/models"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	log "github.com/sirupsen/logrus"
+	"net"
+)
+
+// 发送 DHCPREQUEST 时客户端所处的状态(RFC 2131 4.3.2)
+type requestState string
+
+const (
+	stateSelecting  requestState = "SELECTING"
+	stateInitReboot requestState = "INIT-REBOOT"
+	stateRenewing   requestState = "RENEWING"
+	stateRebinding  requestState = "REBINDING"
+	stateInvalid    requestState = "INVALID"
+)
+
+// 根据 server identifier(option 54), requested ip(option 50) 和 ciaddr 判断客户端状态
+// RENEWING 和 REBINDING 的区别只在于请求是单播还是广播, 直连的客户端无法区分, 两者的处理方式相同
+func parseRequestState(req *dhcpv4.DHCPv4) requestState {
+	hasServerID := req.ServerIdentifier() != nil
+	hasRequestedIP := req.RequestedIPAddress() != nil
+	hasClientIP := req.ClientIPAddr != nil && !req.ClientIPAddr.IsUnspecified()
+
+	switch {
+	case hasServerID && hasRequestedIP && !hasClientIP:
+		return stateSelecting
+	case !hasServerID && hasRequestedIP && !hasClientIP:
+		return stateInitReboot
+	case !hasServerID && !hasRequestedIP && hasClientIP && isRelayed(req):
+		return stateRebinding
+	case !hasServerID && !hasRequestedIP && hasClientIP:
+		return stateRenewing
+	default:
+		return stateInvalid
+	}
+}
+
+// server identifier 是否指向本服务器
+func (h *Handler) isServerID(ip net.IP) bool {
+	if ip.Equal(net.ParseIP(h.subnet.ServerIP)) {
+		return true
+	}
+	for _, addr := range localAddrs {
+		if ip.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 查询客户端在当前地址池中应该使用的地址(绑定的地址或者租约中的地址), 没有记录时返回 nil
+func (h *Handler) recordedIP(network *net.IPNet) net.IP {
+	var lease models.Leases
+
+	if bind, err := h.queryBinding(); err == nil {
+		if ip := net.ParseIP(bind.BindAddr); network.Contains(ip) {
+			return ip
+		}
+	}
+
+	if h.relay != nil && h.relay.circuitID != "" {
+		if relayBind, err := queryRelayBinding(h.relay); err == nil {
+			if ip := net.ParseIP(relayBind.BindAddr); network.Contains(ip) {
+				return ip
+			}
+		}
+	}
+
+	if err := h.whereClient(object.Db).First(&lease).Error; err == nil {
+		return net.ParseIP(lease.AssignedAddr)
+	}
+	return nil
+}
+
+// 地址是否在地址池的可分配地址段中
+func (h *Handler) inRanges(ip net.IP) bool {
+	if ip.To4() == nil {
+		return false
+	}
+	ranges, err := h.poolRanges()
+	if err != nil {
+		return false
+	}
+	n := ipToUint32(ip)
+	for _, r := range ranges {
+		if n >= r.start && n <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// 处理 DHCPREQUEST, 根据客户端状态检查请求的地址, 地址正确时回复 DHCPACK, 否则回复 DHCPNAK
+func (h *Handler) AckHandler() {
+	network, ok := h.subnetNetwork()
+	if !ok {
+		return
+	}
+
+	state := parseRequestState(h.req)
+	h.sign["request_state"] = state
+
+	var requested net.IP
+	switch state {
+	case stateSelecting:
+		// 客户端选择了其他服务器, 释放为其保留的地址并保持沉默
+		if !h.isServerID(h.req.ServerIdentifier()) {
+			log.WithFields(h.sign).Debugf("Client selected another server %s", h.req.ServerIdentifier())
+			h.releaseOffer()
+			return
+		}
+		requested = h.req.RequestedIPAddress()
+		if recorded := h.recordedIP(network); recorded == nil || !recorded.Equal(requested) {
+			h.NakHandler("requested address was not offered")
+			return
+		}
+	case stateInitReboot:
+		requested = h.req.RequestedIPAddress()
+		if !network.Contains(requested) {
+			h.NakHandler("requested address is not on this network")
+			return
+		}
+		recorded := h.recordedIP(network)
+		// 没有此客户端的记录时必须保持沉默
+		if recorded == nil {
+			log.WithFields(h.sign).Debugf("No record of client, remain silent")
+			return
+		}
+		if !recorded.Equal(requested) {
+			h.NakHandler("requested address is not assigned to this client")
+			return
+		}
+	case stateRenewing, stateRebinding:
+		requested = h.req.ClientIPAddr
+		if !network.Contains(requested) {
+			h.NakHandler("client address is not on this network")
+			return
+		}
+		recorded := h.recordedIP(network)
+		// 租约记录已经被删除(例如服务器重建了数据库), 地址空闲时为客户端重新建立租约
+		if recorded == nil {
+			if !h.inRanges(requested) || h.checkIfTaken(requested) {
+				h.NakHandler("client address is not available")
+				return
+			}
+			h.replyWithIP(network, requested)
+			return
+		}
+		if !recorded.Equal(requested) {
+			h.NakHandler("client address is not assigned to this client")
+			return
+		}
+	default:
+		log.WithFields(h.sign).Warningf("Invalid request, ignore it")
+		return
+	}
+
+	assignedIP, err := h.createIP(network)
+	if err != nil {
+		log.WithFields(h.sign).Errorf("Error create IP assigned to client %s", err.Error())
+		h.NakHandler("requested address is not available")
+		return
+	}
+	if !assignedIP.Equal(requested) {
+		h.NakHandler("requested address is not assigned to this client")
+		return
+	}
+	h.replyWithIP(network, assignedIP)
+}
+
+// 回复 DHCPNAK, 通知客户端重新开始获取地址
+func (h *Handler) NakHandler(reason string) {
+	log.WithFields(h.sign).Infof("Send DHCPNAK: %s", reason)
+
+	h.messageType = dhcpv4.MessageTypeNak
+	h.msg.UpdateOption(dhcpv4.OptMessageType(h.messageType))
+	h.msg.UpdateOption(dhcpv4.OptServerIdentifier(net.ParseIP(h.subnet.ServerIP)))
+	h.msg.UpdateOption(dhcpv4.OptMessage(reason))
+	h.msg.YourIPAddr = net.IPv4zero
+	h.msg.ClientIPAddr = net.IPv4zero
+
+	h.writeReply()
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"dhcp/models"
+	"dhcp/models/dbtest"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"testing"
+	"time"
+)
+
+var (
+	testHWAddr = net.HardwareAddr{0x00, 0x50, 0x56, 0xaa, 0xbb, 0xcc}
+	testSubnet = models.Subnet{
+		Name:      "test",
+		CIDR:      "10.1.1.0/24",
+		Ranges:    "10.1.1.10-10.1.1.100",
+		ServerIP:  "10.1.1.1",
+		LeaseTime: "1h",
+	}
+)
+
+// 记录服务器发送的响应
+type testConn struct {
+	net.PacketConn
+	replies []*dhcpv4.DHCPv4
+}
+
+func (c *testConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	msg, err := dhcpv4.FromBytes(b)
+	if err != nil {
+		return 0, err
+	}
+	c.replies = append(c.replies, msg)
+	return len(b), nil
+}
+
+// 使用内存中的表作为数据库, 返回记录写入语句的测试数据库
+func openTestDB(t *testing.T, tables dbtest.Tables) *dbtest.DB {
+	obj, db := dbtest.Open(tables.Handler())
+	object = obj
+	t.Cleanup(func() { object = nil })
+	return db
+}
+
+// 构建处理请求的 Handler, 请求由 modifiers 设置
+func newTestHandler(msgType dhcpv4.MessageType, modifiers ...dhcpv4.Modifier) (*Handler, *testConn) {
+	req, err := dhcpv4.New(append([]dhcpv4.Modifier{dhcpv4.WithHwAddr(testHWAddr)}, modifiers...)...)
+	if err != nil {
+		panic(err)
+	}
+	reply, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		panic(err)
+	}
+	subnet := testSubnet
+	conn := &testConn{}
+	return &Handler{
+		conn:        conn,
+		req:         req,
+		msg:         reply,
+		messageType: msgType,
+		sign:        log.Fields{},
+		options:     &models.Options{},
+		subnet:      &subnet,
+	}, conn
+}
+
+func TestParseRequestState(t *testing.T) {
+	serverID := dhcpv4.WithOption(dhcpv4.OptServerIdentifier(net.IP{10, 1, 1, 1}))
+	requested := dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.IP{10, 1, 1, 20}))
+	clientIP := dhcpv4.WithClientIP(net.IP{10, 1, 1, 20})
+	relayed := dhcpv4.WithGatewayIP(net.IP{10, 2, 1, 1})
+
+	tests := []struct {
+		name      string
+		modifiers []dhcpv4.Modifier
+		state     requestState
+	}{
+		{"selecting", []dhcpv4.Modifier{serverID, requested}, stateSelecting},
+		{"init-reboot", []dhcpv4.Modifier{requested}, stateInitReboot},
+		{"renewing", []dhcpv4.Modifier{clientIP}, stateRenewing},
+		{"rebinding through relay", []dhcpv4.Modifier{clientIP, relayed}, stateRebinding},
+		{"server id without requested ip", []dhcpv4.Modifier{serverID}, stateInvalid},
+		{"requested ip with ciaddr", []dhcpv4.Modifier{requested, clientIP}, stateInvalid},
+		{"server id with ciaddr", []dhcpv4.Modifier{serverID, clientIP}, stateInvalid},
+		{"empty", nil, stateInvalid},
+	}
+	for _, test := range tests {
+		req, err := dhcpv4.New(test.modifiers...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := parseRequestState(req); state != test.state {
+			t.Errorf("%s: parseRequestState() = %s, want %s", test.name, state, test.state)
+		}
+	}
+}
+
+func TestAckHandler(t *testing.T) {
+	ownLease := models.Leases{
+		ClientHWAddr: testHWAddr.String(),
+		AssignedAddr: "10.1.1.20",
+		Subnet:       "test",
+		State:        models.LeaseStateBound,
+		Expires:      time.Now().Add(time.Hour),
+	}
+	otherLease := models.Leases{
+		ClientHWAddr: "00:50:56:11:22:33",
+		AssignedAddr: "10.1.1.20",
+		Subnet:       "test",
+		State:        models.LeaseStateBound,
+		Expires:      time.Now().Add(time.Hour),
+	}
+	requestedIP := func(ip net.IP) dhcpv4.Modifier {
+		return dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(ip))
+	}
+	serverID := func(ip net.IP) dhcpv4.Modifier {
+		return dhcpv4.WithOption(dhcpv4.OptServerIdentifier(ip))
+	}
+
+	tests := []struct {
+		name      string
+		leases    []interface{}
+		modifiers []dhcpv4.Modifier
+		// 期望的响应类型, nil 表示保持沉默
+		reply  *dhcpv4.MessageType
+		yourIP net.IP
+	}{
+		{
+			name:      "selecting offered address",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{serverID(net.IP{10, 1, 1, 1}), requestedIP(net.IP{10, 1, 1, 20})},
+			reply:     &ack,
+			yourIP:    net.IP{10, 1, 1, 20},
+		},
+		{
+			name:      "selecting address that was not offered",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{serverID(net.IP{10, 1, 1, 1}), requestedIP(net.IP{10, 1, 1, 30})},
+			reply:     &nak,
+		},
+		{
+			name:      "selecting another server",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{serverID(net.IP{10, 1, 1, 2}), requestedIP(net.IP{10, 1, 1, 20})},
+		},
+		{
+			name:      "init-reboot with recorded address",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{requestedIP(net.IP{10, 1, 1, 20})},
+			reply:     &ack,
+			yourIP:    net.IP{10, 1, 1, 20},
+		},
+		{
+			name:      "init-reboot with another address",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{requestedIP(net.IP{10, 1, 1, 30})},
+			reply:     &nak,
+		},
+		{
+			name:      "init-reboot on wrong network",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{requestedIP(net.IP{10, 2, 1, 20})},
+			reply:     &nak,
+		},
+		{
+			name:      "init-reboot without record",
+			modifiers: []dhcpv4.Modifier{requestedIP(net.IP{10, 1, 1, 20})},
+		},
+		{
+			name:      "renewing recorded address",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithClientIP(net.IP{10, 1, 1, 20})},
+			reply:     &ack,
+			yourIP:    net.IP{10, 1, 1, 20},
+		},
+		{
+			name:      "renewing another address",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithClientIP(net.IP{10, 1, 1, 30})},
+			reply:     &nak,
+		},
+		{
+			name:      "renewing on wrong network",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithClientIP(net.IP{10, 2, 1, 20})},
+			reply:     &nak,
+		},
+		{
+			name:      "renewing without record, address free",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithClientIP(net.IP{10, 1, 1, 20})},
+			reply:     &ack,
+			yourIP:    net.IP{10, 1, 1, 20},
+		},
+		{
+			name:      "renewing without record, address leased to another client",
+			leases:    []interface{}{otherLease},
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithClientIP(net.IP{10, 1, 1, 20})},
+			reply:     &nak,
+		},
+		{
+			name:      "renewing without record, address out of ranges",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithClientIP(net.IP{10, 1, 1, 200})},
+			reply:     &nak,
+		},
+		{
+			name:      "rebinding through relay",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithClientIP(net.IP{10, 1, 1, 20}), dhcpv4.WithGatewayIP(net.IP{10, 1, 1, 254})},
+			reply:     &ack,
+			yourIP:    net.IP{10, 1, 1, 20},
+		},
+		{
+			name:      "invalid request",
+			leases:    []interface{}{ownLease},
+			modifiers: []dhcpv4.Modifier{serverID(net.IP{10, 1, 1, 1})},
+		},
+	}
+	for _, test := range tests {
+		openTestDB(t, dbtest.Tables{"leases": test.leases})
+		h, conn := newTestHandler(dhcpv4.MessageTypeAck, append(test.modifiers, dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest))...)
+		h.AckHandler()
+
+		if test.reply == nil {
+			if len(conn.replies) != 0 {
+				t.Errorf("%s: reply %s, want no reply", test.name, conn.replies[0].MessageType())
+			}
+			continue
+		}
+		if len(conn.replies) != 1 {
+			t.Errorf("%s: %d replies, want %s", test.name, len(conn.replies), *test.reply)
+			continue
+		}
+		reply := conn.replies[0]
+		if reply.MessageType() != *test.reply {
+			t.Errorf("%s: reply %s, want %s", test.name, reply.MessageType(), *test.reply)
+		}
+		if test.yourIP != nil && !reply.YourIPAddr.Equal(test.yourIP) {
+			t.Errorf("%s: yiaddr %s, want %s", test.name, reply.YourIPAddr, test.yourIP)
+		}
+	}
+}
+
+var (
+	ack = dhcpv4.MessageTypeAck
+	nak = dhcpv4.MessageTypeNak
+)
@@ -2,6 +2,7 @@ package server
 
 import (
 	"dhcp/models"
+	"encoding/hex"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv4/server4"
 	log "github.com/sirupsen/logrus"
@@ -12,38 +13,48 @@ import (
 
 var object *models.Object
 
+var serverConfig *DHCPDConfig
 
-
-func search(action, clientHW string, sign log.Fields) bool {
+// 查询客户端是否匹配 ACL 规则, client identifier 规则优先于 mac 地址规则
+func search(action, clientHW, clientID string, sign log.Fields) bool {
 	var acls []models.ACL
-	if err := object.Db.Where("client_hw_addr = ? and action = ?", clientHW, action).Find(&acls).Error; err != nil {
+	db := object.Db.Where("action = ?", action)
+	if clientID != "" {
+		db = db.Where("client_id = ? or (client_hw_addr = ? and client_id = '')", clientID, clientHW)
+	} else {
+		db = db.Where("client_hw_addr = ? and client_id = ''", clientHW)
+	}
+	if err := db.Find(&acls).Error; err != nil {
 		log.WithFields(sign).Errorf("Error query acl %s", err.Error())
 		return true
 	}
-	for _, item := range acls {
-		if item.ClientHWAddr == clientHW {
-			return true
-		}
-	}
-	return false
+	return len(acls) > 0
 }
 
-func acl(clientHW string, sign log.Fields) bool {
+// 客户端分类的动作与 ACLAction 相同时, 匹配分类的客户端等同于匹配了 ACL 规则
+func acl(msg *dhcpv4.DHCPv4, class *models.ClientClass, sign log.Fields) bool {
 	options := QueryOptions()
 	// 是否打开 ACL 控制
 	if !options.ACL {
 		return false
 	}
 
+	clientHW := msg.ClientHWAddr.String()
+	clientID := clientIdentifier(msg, options)
+	classAction := ""
+	if class != nil {
+		classAction = class.Action
+	}
+
 	switch options.ACLAction {
 	case "allow":
-		if search("allow", clientHW, sign) {
+		if classAction == "allow" || search("allow", clientHW, clientID, sign) {
 			return false
 		}
 		return true
 	case "deny":
 		log.WithFields(sign).Infoln("acl rule mismatch deny")
-		if search("deny", clientHW, sign) {
+		if classAction == "deny" || search("deny", clientHW, clientID, sign) {
 			return true
 		}
 		return false
@@ -53,17 +64,38 @@ func acl(clientHW string, sign log.Fields) bool {
 	}
 }
 
-func handler(conn net.PacketConn, peer net.Addr, msg *dhcpv4.DHCPv4) {
+// 记录日志时用于识别客户端请求的字段
+func requestFields(msg *dhcpv4.DHCPv4) log.Fields {
 	sign := log.Fields{
 		"client_hw_addr": msg.ClientHWAddr,
 		"transaction_id": msg.TransactionID,
 		"hw_type":        msg.HWType,
 		"message_type":   msg.MessageType(),
 	}
+	if relay := parseRelayInfo(msg); relay != nil {
+		sign["circuit_id"] = relay.circuitID
+		sign["remote_id"] = relay.remoteID
+	}
+	if hostname := clientHostname(msg); hostname != "" {
+		sign["hostname"] = hostname
+	}
+	if clientID := msg.Options.Get(dhcpv4.OptionClientIdentifier); clientID != nil {
+		sign["client_id"] = hex.EncodeToString(clientID)
+	}
+	return sign
+}
+
+func handler(conn net.PacketConn, peer net.Addr, msg *dhcpv4.DHCPv4) {
+	sign := requestFields(msg)
+
+	class := matchClientClass(msg, sign)
+	if class != nil {
+		sign["client_class"] = class.Name
+	}
 
 	if msg.MessageType() == dhcpv4.MessageTypeDiscover || msg.MessageType() == dhcpv4.MessageTypeRequest {
 		// 返回 true 则表示禁止为此客户端分配IP地址
-		if acl(msg.ClientHWAddr.String(), sign) {
+		if acl(msg, class, sign) {
 			return
 		}
 	}
@@ -71,26 +103,37 @@ func handler(conn net.PacketConn, peer net.Addr, msg *dhcpv4.DHCPv4) {
 	reply, err := dhcpv4.NewReplyFromRequest(msg)
 	if err != nil {
 		log.WithFields(sign).Errorf("New reply from request %s", err.Error())
+		return
 	}
 
 	switch msg.MessageType() {
 	case dhcpv4.MessageTypeDiscover:
-		NewHandler(conn, peer, reply, dhcpv4.MessageTypeOffer, sign).OfferHandler()
+		NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeOffer, class, sign).OfferHandler()
 	case dhcpv4.MessageTypeRequest:
-		NewHandler(conn, peer, reply, dhcpv4.MessageTypeAck, sign).AckHandler()
+		// PXE 客户端选择启动菜单项之后向启动服务器发送的请求
+		if _, _, ok := parseBootItem(msg); ok {
+			NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeAck, class, sign).BootServerHandler()
+			return
+		}
+		NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeAck, class, sign).AckHandler()
 	case dhcpv4.MessageTypeDecline:
-		NewHandler(conn, peer, reply, dhcpv4.MessageTypeDecline, sign).DeclineHandler()
+		NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeDecline, class, sign).DeclineHandler()
 	case dhcpv4.MessageTypeRelease:
-		NewHandler(conn, peer, reply, dhcpv4.MessageTypeRelease, sign).ReleaseHandler()
+		NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeRelease, class, sign).ReleaseHandler()
+	case dhcpv4.MessageTypeInform:
+		NewHandler(conn, peer, msg, reply, dhcpv4.MessageTypeAck, class, sign).InformHandler()
 	default:
 		log.WithFields(sign).Infoln("An unknown request was received")
 	}
 }
 
 type DHCPDConfig struct {
-	Listen                string
-	Port                  int
-	IFName                string
+	Listen string
+	Port   int
+	IFName string
+	// dhcp: 分配地址, proxy: ProxyDHCP 模式, 只为 PXE 客户端提供启动信息
+	Mode                  string
+	RawUnicast            bool
 	Debug                 bool
 	DBUser                string
 	DBHost                string
@@ -103,14 +146,23 @@ type DHCPDConfig struct {
 }
 
 func DHCPD(d *DHCPDConfig, logLevel logger.LogLevel, connMaxLifetime time.Duration) {
+	serverConfig = d
 	object = models.MustConnectDB(d.DBUser, d.DBHost, d.DBPass, d.DBName, d.DBPort, logLevel, d.DBPoolMaxIdleConns, d.DBPoolMaxOpenConns, connMaxLifetime)
 
+	localAddrs = interfaceAddrs(d.IFName)
+
 	laddr := net.UDPAddr{
 		IP:   net.ParseIP(d.Listen),
 		Port: d.Port,
 	}
 
-	server, err := server4.NewServer(d.IFName, &laddr, handler)
+	h, bootServer := handler, server4.Handler(bootServerHandler)
+	if d.Mode == ModeProxy {
+		h, bootServer = proxyHandler(d.Port), proxyHandler(pxeBootServerPort)
+	}
+	go serveBootServer(d, bootServer)
+
+	server, err := server4.NewServer(d.IFName, &laddr, h)
 	if err != nil {
 		panic(err)
 	}
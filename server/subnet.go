@@ -0,0 +1,254 @@
+package server
+
+import (
+	"dhcp/models"
+	"fmt"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"time"
+)
+
+// dhcpd 监听接口上配置的 IPv4 地址, 用于为直连的客户端选择地址池
+var localAddrs []net.IP
+
+// 获取监听接口的 IPv4 地址, 未指定接口时返回所有接口的地址
+func interfaceAddrs(ifname string) []net.IP {
+	var addrs []net.Addr
+	var err error
+	if ifname == "" {
+		addrs, err = net.InterfaceAddrs()
+	} else {
+		var iface *net.Interface
+		iface, err = net.InterfaceByName(ifname)
+		if err == nil {
+			addrs, err = iface.Addrs()
+		}
+	}
+	if err != nil {
+		log.Errorf("Error query interface %s address %s", ifname, err.Error())
+		return nil
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+	return ips
+}
+
+// 使用 Options 中的地址范围构建默认地址池(兼容只有单个地址池的旧配置)
+func defaultSubnet(options *models.Options) (*models.Subnet, error) {
+	netmask, err := getNetmask(options.NetMask)
+	if err != nil {
+		return nil, err
+	}
+	start := net.ParseIP(options.RangeStartIP).To4()
+	if start == nil {
+		return nil, errors.New("invalid range start ip")
+	}
+	network := net.IPNet{IP: start.Mask(netmask), Mask: netmask}
+	return &models.Subnet{
+		Name:   "default",
+		CIDR:   network.String(),
+		Ranges: fmt.Sprintf("%s-%s", options.RangeStartIP, options.RangeEndIP),
+		NetworkOptions: models.NetworkOptions{
+			BroadcastAddr: options.BroadcastAddr,
+		},
+	}, nil
+}
+
+// 地址池中留空的配置项继承全局配置
+func inheritOptions(subnet *models.Subnet, options *models.Options) {
+	if subnet.ServerIP == "" {
+		subnet.ServerIP = options.ServerIP
+	}
+	if subnet.Router == "" {
+		subnet.Router = options.Router
+	}
+	if subnet.DNS == "" {
+		subnet.DNS = options.DNS
+	}
+	if subnet.LeaseTime == "" {
+		subnet.LeaseTime = options.LeaseTime
+	}
+	if subnet.BootFileName == "" {
+		subnet.BootFileName = options.BootFileName
+	}
+	if subnet.RenewalTime == "" {
+		subnet.RenewalTime = options.RenewalTime
+	}
+	if subnet.RebindingTime == "" {
+		subnet.RebindingTime = options.RebindingTime
+	}
+	if subnet.HostnamePattern == "" {
+		subnet.HostnamePattern = options.HostnamePattern
+	}
+	if subnet.IPXEScriptURL == "" {
+		subnet.IPXEScriptURL = options.IPXEScriptURL
+	}
+	if subnet.HTTPBootURL == "" {
+		subnet.HTTPBootURL = options.HTTPBootURL
+	}
+	if subnet.DomainName == "" {
+		subnet.DomainName = options.DomainName
+	}
+	if subnet.DomainSearch == "" {
+		subnet.DomainSearch = options.DomainSearch
+	}
+	if subnet.NTPServers == "" {
+		subnet.NTPServers = options.NTPServers
+	}
+	if subnet.PXEDiscoveryControl == "" {
+		subnet.PXEDiscoveryControl = options.PXEDiscoveryControl
+	}
+	if subnet.PXEMenuPrompt == "" {
+		subnet.PXEMenuPrompt = options.PXEMenuPrompt
+	}
+	if subnet.PXEMenuTimeout == "" {
+		subnet.PXEMenuTimeout = options.PXEMenuTimeout
+	}
+	// 广播地址只对所在的子网有效, 不继承全局配置
+	if subnet.MTU == "" {
+		subnet.MTU = options.MTU
+	}
+	if subnet.ClasslessRoutes == "" {
+		subnet.ClasslessRoutes = options.ClasslessRoutes
+	}
+	if subnet.MinLeaseTime == "" && subnet.MaxLeaseTime == "" {
+		subnet.MinLeaseTime = options.MinLeaseTime
+		subnet.MaxLeaseTime = options.MaxLeaseTime
+	}
+}
+
+// 查询所有地址池, 返回的地址池已经继承了全局配置
+// 如果没有配置任何地址池则使用 Options 中的地址范围作为默认地址池
+func QuerySubnets(options *models.Options) []models.Subnet {
+	var subnets []models.Subnet
+	if err := object.Db.Find(&subnets).Error; err != nil {
+		log.Errorf("QuerySubnets %s", err.Error())
+	}
+
+	if len(subnets) == 0 {
+		subnet, err := defaultSubnet(options)
+		if err != nil {
+			log.Errorf("Error build default subnet %s", err.Error())
+			return nil
+		}
+		subnets = append(subnets, *subnet)
+	}
+
+	for i := range subnets {
+		inheritOptions(&subnets[i], options)
+	}
+	return subnets
+}
+
+// 返回包含 ip 的地址池
+func findSubnet(subnets []models.Subnet, ip net.IP) *models.Subnet {
+	for i := range subnets {
+		network, err := parseCIDR(subnets[i].CIDR)
+		if err != nil {
+			log.Errorf("Error parsing subnet %s cidr %s", subnets[i].Name, err.Error())
+			continue
+		}
+		if network.Contains(ip) {
+			return &subnets[i]
+		}
+	}
+	return nil
+}
+
+// 为客户端请求选择地址池
+// 1. 经过中继代理转发的请求根据 giaddr 选择
+// 2. 已有地址的客户端(续约)根据 ciaddr 选择
+// 3. 直连的客户端根据监听接口的地址选择
+// 4. 只有一个地址池时直接使用此地址池
+func selectSubnet(req *dhcpv4.DHCPv4, options *models.Options) *models.Subnet {
+	subnets := QuerySubnets(options)
+
+	if isRelayed(req) {
+		return findSubnet(subnets, req.GatewayIPAddr)
+	}
+
+	if ip := req.ClientIPAddr; ip != nil && !ip.IsUnspecified() {
+		if subnet := findSubnet(subnets, ip); subnet != nil {
+			return subnet
+		}
+	}
+
+	for _, addr := range localAddrs {
+		if subnet := findSubnet(subnets, addr); subnet != nil {
+			return subnet
+		}
+	}
+
+	if len(subnets) == 1 {
+		return &subnets[0]
+	}
+	return nil
+}
+
+// 检查地址池配置是否合法
+func CheckSubnet(subnet *models.Subnet) error {
+	network, err := parseCIDR(subnet.CIDR)
+	if err != nil {
+		return err
+	}
+
+	ranges, err := parseRanges(subnet.Ranges)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if !network.Contains(uint32ToIP(r.start)) || !network.Contains(uint32ToIP(r.end)) {
+			return errors.New(fmt.Sprintf("address range %s-%s is not in subnet %s", uint32ToIP(r.start), uint32ToIP(r.end), subnet.CIDR))
+		}
+	}
+
+	if subnet.ServerIP != "" && net.ParseIP(subnet.ServerIP).To4() == nil {
+		return errors.New("invalid server ip")
+	}
+	for _, field := range []string{subnet.Router, subnet.DNS} {
+		if field == "" {
+			continue
+		}
+		for _, ip := range parse(field) {
+			if ip.To4() == nil {
+				return errors.New("invalid router or dns address")
+			}
+		}
+	}
+
+	for _, field := range []string{subnet.LeaseTime, subnet.RenewalTime, subnet.RebindingTime, subnet.MinLeaseTime, subnet.MaxLeaseTime} {
+		if field == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(field); err != nil {
+			return err
+		}
+	}
+	if err := CheckLeaseTimeRange(subnet.LeaseTime, subnet.MinLeaseTime, subnet.MaxLeaseTime); err != nil {
+		return err
+	}
+	if subnet.BroadcastAddr != "" {
+		if ip := net.ParseIP(subnet.BroadcastAddr); ip == nil || !network.Contains(ip) {
+			return errors.New(fmt.Sprintf("broadcast address %s is not in subnet %s", subnet.BroadcastAddr, subnet.CIDR))
+		}
+	}
+	if err := CheckNetworkOptions(&subnet.NetworkOptions); err != nil {
+		return err
+	}
+	for _, field := range []string{subnet.IPXEScriptURL, subnet.HTTPBootURL} {
+		if err := CheckBootURL(field); err != nil {
+			return err
+		}
+	}
+	if err := CheckPXEOptions(&subnet.PXEOptions); err != nil {
+		return err
+	}
+	return CheckHostnamePattern(subnet.HostnamePattern)
+}
@@ -36,6 +36,9 @@ func getNetmask(ipMask string) (net.IPMask, error) {
 }
 
 func random(min uint32, max uint32) uint32 {
+	if max <= min {
+		return min
+	}
 	return uint32(rand.Intn(int(max-min))) + min
 }
 
@@ -47,3 +50,59 @@ func parse(addrs string) (ips []net.IP) {
 	}
 	return ips
 }
+
+// 地址段, 起止地址均包含在内
+type ipRange struct {
+	start uint32
+	end   uint32
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
+
+// 将以逗号(,)分隔的地址段列表(如 10.1.1.10-10.1.1.100)转换为 []ipRange 对象
+func parseRanges(ranges string) ([]ipRange, error) {
+	var result []ipRange
+	for _, item := range strings.Split(ranges, ",") {
+		item = strings.Trim(item, " ")
+		if item == "" {
+			continue
+		}
+		pair := strings.Split(item, "-")
+		if len(pair) != 2 {
+			return nil, errors.New("invalid address range " + item)
+		}
+		start := net.ParseIP(strings.Trim(pair[0], " ")).To4()
+		end := net.ParseIP(strings.Trim(pair[1], " ")).To4()
+		if start == nil || end == nil {
+			return nil, errors.New("invalid address range " + item)
+		}
+		if ipToUint32(start) > ipToUint32(end) {
+			return nil, errors.New("range start is greater than range end " + item)
+		}
+		result = append(result, ipRange{start: ipToUint32(start), end: ipToUint32(end)})
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no address range specified")
+	}
+	return result, nil
+}
+
+// 解析 CIDR 格式的子网, 只支持 IPv4
+func parseCIDR(cidr string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if network.IP.To4() == nil {
+		return nil, errors.New("only IPv4 subnets are supported")
+	}
+	return network, nil
+}
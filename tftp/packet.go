@@ -0,0 +1,89 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// TFTP 操作码(RFC 1350, RFC 2347)
+const (
+	opRRQ   uint16 = 1
+	opWRQ   uint16 = 2
+	opDATA  uint16 = 3
+	opACK   uint16 = 4
+	opERROR uint16 = 5
+	opOACK  uint16 = 6
+)
+
+// TFTP 错误码
+const (
+	errNotDefined       uint16 = 0
+	errFileNotFound     uint16 = 1
+	errAccessViolation  uint16 = 2
+	errIllegalOperation uint16 = 4
+	errUnknownTID       uint16 = 5
+)
+
+// 读请求
+type readRequest struct {
+	filename string
+	mode     string
+	// 选项名称统一为小写
+	options map[string]string
+	// 客户端发送选项的顺序, OACK 按照此顺序回应
+	optionOrder []string
+}
+
+// 解析 RRQ 或者 WRQ, 格式为 filename 0 mode 0 [option 0 value 0]...
+func parseRequest(data []byte) (*readRequest, error) {
+	if len(data) < 2 {
+		return nil, errors.New("short packet")
+	}
+	fields := bytes.Split(data[2:], []byte{0})
+	// 最后一个字段以 0 结尾, 分割之后最后一项为空
+	if len(fields) < 3 || len(fields[len(fields)-1]) != 0 {
+		return nil, errors.New("malformed request")
+	}
+	fields = fields[:len(fields)-1]
+
+	req := &readRequest{
+		filename: string(fields[0]),
+		mode:     strings.ToLower(string(fields[1])),
+		options:  make(map[string]string),
+	}
+	for i := 2; i+1 < len(fields); i += 2 {
+		name := strings.ToLower(string(fields[i]))
+		req.options[name] = string(fields[i+1])
+		req.optionOrder = append(req.optionOrder, name)
+	}
+	return req, nil
+}
+
+func dataPacket(block uint16, data []byte) []byte {
+	packet := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(packet, opDATA)
+	binary.BigEndian.PutUint16(packet[2:], block)
+	return append(packet, data...)
+}
+
+func errorPacket(code uint16, message string) []byte {
+	packet := make([]byte, 4, 5+len(message))
+	binary.BigEndian.PutUint16(packet, opERROR)
+	binary.BigEndian.PutUint16(packet[2:], code)
+	packet = append(packet, message...)
+	return append(packet, 0)
+}
+
+func oackPacket(names []string, values map[string]string) []byte {
+	packet := make([]byte, 2)
+	binary.BigEndian.PutUint16(packet, opOACK)
+	for _, name := range names {
+		packet = append(packet, name...)
+		packet = append(packet, 0)
+		packet = append(packet, values[name]...)
+		packet = append(packet, 0)
+	}
+	return packet
+}
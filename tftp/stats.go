@@ -0,0 +1,77 @@
+package tftp
+
+import (
+	"sync"
+	"time"
+)
+
+// 保留的最近传输记录数量
+const maxRecentTransfers = 100
+
+// 单次传输的记录
+type Transfer struct {
+	Client    string    `json:"client"`
+	Filename  string    `json:"filename"`
+	BlockSize int       `json:"block_size"`
+	Window    int       `json:"window_size"`
+	Bytes     int64     `json:"bytes"`
+	Start     time.Time `json:"start"`
+	Duration  string    `json:"duration"`
+	Aborted   bool      `json:"aborted"`
+	Error     string    `json:"error"`
+}
+
+// TFTP 服务器的传输统计, Aborted 为客户端在选项协商之后主动中止的传输(通常只是为了获取文件大小)
+type Stats struct {
+	Enabled   bool       `json:"enabled"`
+	Active    int        `json:"active"`
+	Completed int64      `json:"completed"`
+	Aborted   int64      `json:"aborted"`
+	Failed    int64      `json:"failed"`
+	BytesSent int64      `json:"bytes_sent"`
+	Recent    []Transfer `json:"recent"`
+}
+
+var (
+	stats     Stats
+	statsLock sync.Mutex
+)
+
+func transferStarted() {
+	statsLock.Lock()
+	stats.Active++
+	statsLock.Unlock()
+}
+
+func transferFinished(transfer Transfer) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	stats.Active--
+	stats.BytesSent += transfer.Bytes
+	switch {
+	case transfer.Aborted:
+		stats.Aborted++
+	case transfer.Error == "":
+		stats.Completed++
+	default:
+		stats.Failed++
+	}
+	stats.Recent = append(stats.Recent, transfer)
+	if len(stats.Recent) > maxRecentTransfers {
+		stats.Recent = stats.Recent[len(stats.Recent)-maxRecentTransfers:]
+	}
+}
+
+// 返回当前的传输统计, 最近的传输记录在前
+func QueryStats() Stats {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	result := stats
+	result.Recent = make([]Transfer, len(stats.Recent))
+	for i, transfer := range stats.Recent {
+		result.Recent[len(stats.Recent)-1-i] = transfer
+	}
+	return result
+}
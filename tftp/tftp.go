@@ -0,0 +1,423 @@
+package tftp
+
+import (
+	"bytes"
+	"dhcp/bootcfg"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBlockSize = 512
+	// RFC 2348 规定的 blksize 范围
+	minBlockSize = 8
+	maxBlockSize = 65464
+	// RFC 7440 规定 windowsize 最大为 65535, 过大的窗口在丢包时重传代价很高, 所以限制为 64
+	maxWindowSize  = 64
+	defaultTimeout = 3 * time.Second
+	maxRetries     = 5
+	// 没有配置 MaxTransfers 时同时进行的最大传输数量
+	defaultMaxTransfers = 64
+)
+
+// 只读的 TFTP 服务器(RFC 1350), 支持 blksize(RFC 2348), tsize 和 timeout(RFC 2349), windowsize(RFC 7440) 选项
+type TFTPDConfig struct {
+	Listen string
+	// 根目录, 客户端只能读取根目录中的文件
+	Root string
+	// 同时进行的最大传输数量, 超过时丢弃新的请求(客户端会重传请求)
+	MaxTransfers int
+}
+
+func TFTPD(t *TFTPDConfig) {
+	root, err := filepath.Abs(t.Root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	conn, err := net.ListenPacket("udp4", t.Listen)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	statsLock.Lock()
+	stats.Enabled = true
+	statsLock.Unlock()
+
+	// 传输的源地址必须是客户端请求的目的地址, 监听所有地址时通过 IP_PKTINFO 获取每个请求的目的地址
+	listenIP := net.IPv4zero
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		listenIP = addr.IP
+	}
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetControlMessage(ipv4.FlagDst, true); err != nil {
+		log.Warningf("Error enable tftp destination address control message %s", err.Error())
+	}
+
+	maxTransfers := t.MaxTransfers
+	if maxTransfers <= 0 {
+		maxTransfers = defaultMaxTransfers
+	}
+	transfers := make(chan struct{}, maxTransfers)
+
+	buf := make([]byte, 65536)
+	for {
+		n, cm, peer, err := pc.ReadFrom(buf)
+		if err != nil {
+			log.Errorf("Error read tftp request %s", err.Error())
+			continue
+		}
+		localIP := listenIP
+		if cm != nil && cm.Dst != nil && (cm.Dst.IsGlobalUnicast() || cm.Dst.IsLoopback()) {
+			localIP = cm.Dst
+		}
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+
+		select {
+		case transfers <- struct{}{}:
+			go func() {
+				defer func() { <-transfers }()
+				handleRequest(root, localIP, peer, packet)
+			}()
+		default:
+			log.Warningf("Too many tftp transfers, drop request from %s", peer)
+		}
+	}
+}
+
+// 处理客户端的请求, 每个传输使用独立的端口(TID)
+func handleRequest(root string, localIP net.IP, peer net.Addr, packet []byte) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: localIP})
+	if err != nil {
+		log.Errorf("Error listen tftp transfer %s", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	if len(packet) < 2 {
+		return
+	}
+	switch binary.BigEndian.Uint16(packet) {
+	case opRRQ:
+	case opWRQ:
+		conn.WriteTo(errorPacket(errAccessViolation, "write not supported"), peer)
+		return
+	default:
+		conn.WriteTo(errorPacket(errIllegalOperation, "illegal operation"), peer)
+		return
+	}
+
+	req, err := parseRequest(packet)
+	if err != nil {
+		conn.WriteTo(errorPacket(errIllegalOperation, err.Error()), peer)
+		return
+	}
+	sign := log.Fields{"client": peer.String(), "filename": req.filename}
+
+	// 启动文件都是二进制文件, 不支持需要转换换行符的 netascii 模式
+	if req.mode != "octet" {
+		conn.WriteTo(errorPacket(errIllegalOperation, "unsupported mode "+req.mode), peer)
+		return
+	}
+
+	file, err := openFile(root, req.filename)
+	if err != nil {
+		log.WithFields(sign).Infof("Error open tftp file %s", err.Error())
+		// 不向客户端返回服务器上的路径
+		if os.IsNotExist(errors.Cause(err)) {
+			conn.WriteTo(errorPacket(errFileNotFound, "file not found"), peer)
+		} else {
+			conn.WriteTo(errorPacket(errAccessViolation, "access violation"), peer)
+		}
+		return
+	}
+	defer file.Close()
+
+	t := &transfer{
+		conn:      conn,
+		peer:      peer,
+		file:      file,
+		size:      file.size,
+		blockSize: defaultBlockSize,
+		window:    1,
+		timeout:   defaultTimeout,
+	}
+	record := Transfer{Client: peer.String(), Filename: req.filename, Start: time.Now()}
+
+	transferStarted()
+	err = t.run(req)
+	record.BlockSize = t.blockSize
+	record.Window = t.window
+	record.Bytes = t.sent
+	record.Duration = time.Since(record.Start).String()
+	record.Aborted = t.aborted
+	if t.aborted {
+		log.WithFields(sign).Debugf("TFTP transfer aborted by client after option negotiation")
+	} else if err != nil {
+		record.Error = err.Error()
+		log.WithFields(sign).Warningf("Error tftp transfer %s", err.Error())
+		// 客户端发送的 ERROR 不需要回应
+		if _, ok := err.(*clientError); !ok {
+			conn.WriteTo(errorPacket(errNotDefined, "transfer failed"), peer)
+		}
+	} else {
+		log.WithFields(sign).Debugf("TFTP transfer completed, %d bytes in %s", t.sent, record.Duration)
+		if file.generated {
+			bootcfg.Delivered(req.filename)
+		}
+	}
+	transferFinished(record)
+}
+
+// 可以通过 TFTP 读取的文件, generated 表示由 bootcfg 生成的启动配置
+type readFile struct {
+	io.ReaderAt
+	io.Closer
+	size      int64
+	generated bool
+}
+
+// 打开根目录中的文件, 文件名中的 .. 和指向根目录以外的符号链接都不允许访问根目录以外的文件
+// 部分 PXE 客户端使用 \ 作为路径分隔符
+// 绑定了安装配置的客户端的 pxelinux 和 grub 配置由 bootcfg 生成, 优先于根目录中的文件
+func openFile(root, filename string) (*readFile, error) {
+	if data, ok := bootcfg.Render(filename); ok {
+		reader := bytes.NewReader(data)
+		return &readFile{ReaderAt: reader, Closer: io.NopCloser(reader), size: reader.Size(), generated: true}, nil
+	}
+
+	name := path.Clean("/" + strings.ReplaceAll(filename, "\\", "/"))
+	fullPath, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, errors.Wrap(err, "file not found")
+	}
+	if fullPath != root && !strings.HasPrefix(fullPath, root+string(filepath.Separator)) {
+		return nil, errors.New("access violation")
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return nil, errors.New("not a regular file")
+	}
+	return &readFile{ReaderAt: file, Closer: file, size: info.Size()}, nil
+}
+
+type transfer struct {
+	conn      *net.UDPConn
+	peer      net.Addr
+	file      io.ReaderAt
+	size      int64
+	blockSize int
+	window    int
+	timeout   time.Duration
+	sent      int64
+	// 客户端在选项协商之后中止了传输
+	aborted bool
+}
+
+// 协商选项, 返回需要在 OACK 中回应的选项, 不支持或者不合法的选项被忽略
+func (t *transfer) negotiate(req *readRequest) ([]string, map[string]string) {
+	var names []string
+	values := make(map[string]string)
+	for _, name := range req.optionOrder {
+		value := req.options[name]
+		switch name {
+		case "blksize":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < minBlockSize {
+				continue
+			}
+			if n > maxBlockSize {
+				n = maxBlockSize
+			}
+			t.blockSize = n
+			values[name] = strconv.Itoa(n)
+		case "tsize":
+			values[name] = strconv.FormatInt(t.size, 10)
+		case "timeout":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 255 {
+				continue
+			}
+			t.timeout = time.Duration(n) * time.Second
+			values[name] = value
+		case "windowsize":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 65535 {
+				continue
+			}
+			if n > maxWindowSize {
+				n = maxWindowSize
+			}
+			t.window = n
+			values[name] = strconv.Itoa(n)
+		default:
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, values
+}
+
+// 等待客户端的 ACK, 返回确认的块号(16 位)
+func (t *transfer) waitAck() (uint16, error) {
+	buf := make([]byte, 1024)
+	deadline := time.Now().Add(t.timeout)
+	for {
+		if err := t.conn.SetReadDeadline(deadline); err != nil {
+			return 0, err
+		}
+		n, peer, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		// 其他地址发送的报文(RFC 1350 TID 不匹配)
+		if peer.String() != t.peer.String() {
+			t.conn.WriteTo(errorPacket(errUnknownTID, "unknown transfer id"), peer)
+			continue
+		}
+		if n < 4 {
+			continue
+		}
+		switch binary.BigEndian.Uint16(buf) {
+		case opACK:
+			return binary.BigEndian.Uint16(buf[2:]), nil
+		case opERROR:
+			return 0, &clientError{code: binary.BigEndian.Uint16(buf[2:]), message: strings.TrimRight(string(buf[4:n]), "\x00")}
+		}
+	}
+}
+
+// 客户端发送的 ERROR
+type clientError struct {
+	code    uint16
+	message string
+}
+
+func (e *clientError) Error() string {
+	return fmt.Sprintf("client error %d %s", e.code, e.message)
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// 发送第 n 个数据块(从 1 开始), 块号超过 65535 之后从 0 开始循环
+func (t *transfer) sendBlock(n int64) error {
+	buf := make([]byte, t.blockSize)
+	offset := (n - 1) * int64(t.blockSize)
+	length, err := t.file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if _, err := t.conn.WriteTo(dataPacket(uint16(n), buf[:length]), t.peer); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *transfer) run(req *readRequest) error {
+	names, values := t.negotiate(req)
+	if len(names) > 0 {
+		// 发送 OACK 并等待客户端确认(ACK 0)
+		oack := oackPacket(names, values)
+		for retries := 0; ; retries++ {
+			if retries > maxRetries {
+				return errors.New("timeout waiting for option acknowledgement")
+			}
+			if _, err := t.conn.WriteTo(oack, t.peer); err != nil {
+				return err
+			}
+			block, err := t.waitAck()
+			if isTimeout(err) {
+				continue
+			}
+			if err != nil {
+				// PXE 客户端通常先通过 tsize 获取文件大小, 然后发送 ERROR 中止传输
+				if _, ok := err.(*clientError); ok {
+					t.aborted = true
+				}
+				return err
+			}
+			if block == 0 {
+				break
+			}
+		}
+	}
+
+	// 最后一个数据块小于块大小, 文件大小是块大小的整数倍时最后发送一个空的数据块
+	totalBlocks := t.size/int64(t.blockSize) + 1
+	var acked int64
+	resend := true
+	for retries := 0; acked < totalBlocks; {
+		if retries > maxRetries {
+			return errors.New(fmt.Sprintf("timeout waiting for acknowledgement of block %d", acked+1))
+		}
+
+		last := acked + int64(t.window)
+		if last > totalBlocks {
+			last = totalBlocks
+		}
+		if resend {
+			for n := acked + 1; n <= last; n++ {
+				if err := t.sendBlock(n); err != nil {
+					return err
+				}
+			}
+		}
+
+		block, err := t.waitAck()
+		if isTimeout(err) {
+			retries++
+			resend = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// 将 16 位的块号转换为发送窗口中的块
+		// 重复确认上一个窗口时不立即重传, 避免 Sorcerer's Apprentice 问题(RFC 1123 4.2.3.1)
+		resend = false
+		for n := acked + 1; n <= last; n++ {
+			if uint16(n) == block {
+				acked = n
+				retries = 0
+				resend = true
+				break
+			}
+		}
+		// 窗口中部分数据块丢失, 客户端确认了收到的最后一个连续的数据块, 从下一个数据块开始重传
+		if t.window > 1 && !resend && block == uint16(acked) {
+			resend = true
+		}
+
+		t.sent = acked * int64(t.blockSize)
+		if t.sent > t.size {
+			t.sent = t.size
+		}
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   [][2]string
+		names     []string
+		values    map[string]string
+		blockSize int
+		window    int
+		timeout   time.Duration
+	}{
+		{
+			name:      "no options",
+			blockSize: defaultBlockSize,
+			window:    1,
+			timeout:   defaultTimeout,
+		},
+		{
+			// OACK 按照客户端发送的顺序回应, tsize 回应文件大小
+			name:      "all options",
+			options:   [][2]string{{"windowsize", "8"}, {"tsize", "0"}, {"blksize", "1468"}, {"timeout", "5"}},
+			names:     []string{"windowsize", "tsize", "blksize", "timeout"},
+			values:    map[string]string{"windowsize": "8", "tsize": "1000", "blksize": "1468", "timeout": "5"},
+			blockSize: 1468,
+			window:    8,
+			timeout:   5 * time.Second,
+		},
+		{
+			name:      "clamp block size and window",
+			options:   [][2]string{{"blksize", "70000"}, {"windowsize", "1000"}},
+			names:     []string{"blksize", "windowsize"},
+			values:    map[string]string{"blksize": "65464", "windowsize": "64"},
+			blockSize: maxBlockSize,
+			window:    maxWindowSize,
+			timeout:   defaultTimeout,
+		},
+		{
+			// 不合法的值和不支持的选项被忽略, 不在 OACK 中回应
+			name:      "invalid options",
+			options:   [][2]string{{"blksize", "4"}, {"windowsize", "0"}, {"timeout", "256"}, {"timeout", "x"}, {"multicast", ""}},
+			values:    map[string]string{},
+			blockSize: defaultBlockSize,
+			window:    1,
+			timeout:   defaultTimeout,
+		},
+	}
+	for _, test := range tests {
+		req := &readRequest{options: make(map[string]string)}
+		for _, option := range test.options {
+			req.options[option[0]] = option[1]
+			req.optionOrder = append(req.optionOrder, option[0])
+		}
+		tr := &transfer{size: 1000, blockSize: defaultBlockSize, window: 1, timeout: defaultTimeout}
+		names, values := tr.negotiate(req)
+
+		if len(names) != len(test.names) {
+			t.Errorf("%s: negotiated %q, want %q", test.name, names, test.names)
+		} else {
+			for i := range names {
+				if names[i] != test.names[i] || values[names[i]] != test.values[names[i]] {
+					t.Errorf("%s: option %s=%s, want %s=%s", test.name, names[i], values[names[i]], test.names[i], test.values[test.names[i]])
+				}
+			}
+		}
+		if tr.blockSize != test.blockSize || tr.window != test.window || tr.timeout != test.timeout {
+			t.Errorf("%s: blksize %d, window %d, timeout %s, want %d, %d, %s", test.name, tr.blockSize, tr.window, tr.timeout, test.blockSize, test.window, test.timeout)
+		}
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	for _, d := range []string{root, filepath.Join(root, "pxelinux")} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range map[string]string{
+		filepath.Join(root, "pxelinux.0"):           "boot",
+		filepath.Join(root, "pxelinux", "menu.c32"): "menu",
+		filepath.Join(dir, "secret"):                "secret",
+	} {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "pxelinux.0"), filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filename string
+		data     string
+	}{
+		{"pxelinux.0", "boot"},
+		{"/pxelinux.0", "boot"},
+		{"pxelinux/menu.c32", "menu"},
+		{"pxelinux\\menu.c32", "menu"},
+		{"inside", "boot"},
+		// .. 不能离开根目录
+		{"../secret", ""},
+		{"..\\secret", ""},
+		{"pxelinux/../../secret", ""},
+		// 指向根目录以外的符号链接
+		{"outside", ""},
+		// 目录不是普通文件
+		{"pxelinux", ""},
+		{"missing", ""},
+	}
+	for _, test := range tests {
+		file, err := openFile(root, test.filename)
+		if test.data == "" {
+			if err == nil {
+				file.Close()
+				t.Errorf("openFile(%q) expected error", test.filename)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("openFile(%q) error %s", test.filename, err)
+			continue
+		}
+		buf := make([]byte, file.size)
+		if _, err := file.ReadAt(buf, 0); err != nil || string(buf) != test.data {
+			t.Errorf("openFile(%q) read %q, %v, want %q", test.filename, buf, err, test.data)
+		}
+		file.Close()
+	}
+}
+
+// 测试客户端, 在回环地址上接收数据块并发送 ACK
+type testClient struct {
+	t    *testing.T
+	conn *net.UDPConn
+	// 服务器的传输端口
+	server net.Addr
+}
+
+func newTestClient(t *testing.T) *testClient {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn}
+}
+
+// 读取服务器发送的报文, 返回操作码和操作码之后的内容
+func (c *testClient) read() (uint16, []byte) {
+	buf := make([]byte, 65536)
+	if err := c.conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		c.t.Fatal(err)
+	}
+	n, peer, err := c.conn.ReadFrom(buf)
+	if err != nil {
+		c.t.Fatalf("read from server %s", err)
+	}
+	c.server = peer
+	return binary.BigEndian.Uint16(buf), buf[2:n]
+}
+
+func (c *testClient) ack(block uint16) {
+	packet := make([]byte, 4)
+	binary.BigEndian.PutUint16(packet, opACK)
+	binary.BigEndian.PutUint16(packet[2:], block)
+	if _, err := c.conn.WriteTo(packet, c.server); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// 接收文件, 每个窗口确认一次, drop 返回 true 的数据块被丢弃(模拟丢包)
+// 窗口中出现丢包时确认最后一个连续的数据块, 与 RFC 7440 的客户端行为相同
+func (c *testClient) receive(blockSize, window int, drop func(n int64) bool) []byte {
+	var data []byte
+	var received int64
+	inWindow := 0
+	gap := false
+	for {
+		op, packet := c.read()
+		if op != opDATA {
+			c.t.Fatalf("unexpected opcode %d", op)
+		}
+		block, payload := binary.BigEndian.Uint16(packet), packet[2:]
+		if block != uint16(received+1) {
+			// 丢包之后收到的数据块, 确认最后一个连续的数据块, 每次丢包只确认一次
+			if !gap && block == uint16(received+2) {
+				gap = true
+				inWindow = 0
+				c.ack(uint16(received))
+			}
+			continue
+		}
+		if drop(received + 1) {
+			continue
+		}
+		gap = false
+		received++
+		data = append(data, payload...)
+		inWindow++
+		last := len(payload) < blockSize
+		if inWindow == window || last {
+			inWindow = 0
+			c.ack(block)
+		}
+		if last {
+			return data
+		}
+	}
+}
+
+func newTestTransfer(t *testing.T, client *testClient, file []byte, blockSize, window int) *transfer {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &transfer{
+		conn:      conn,
+		peer:      client.conn.LocalAddr(),
+		file:      bytes.NewReader(file),
+		size:      int64(len(file)),
+		blockSize: blockSize,
+		window:    window,
+		timeout:   200 * time.Millisecond,
+	}
+}
+
+func testFile(size int) []byte {
+	file := make([]byte, size)
+	for i := range file {
+		file[i] = byte(i * 7)
+	}
+	return file
+}
+
+func TestTransferRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		blockSize int
+		window    int
+		drop      func(n int64) bool
+	}{
+		{
+			name:      "single block",
+			size:      100,
+			blockSize: 512,
+			window:    1,
+		},
+		{
+			// 文件大小是块大小的整数倍时最后发送一个空的数据块
+			name:      "multiple of block size",
+			size:      1024,
+			blockSize: 512,
+			window:    1,
+		},
+		{
+			// 块号超过 65535 之后从 0 开始循环
+			name:      "block number wraps",
+			size:      8*70000 + 3,
+			blockSize: 8,
+			window:    maxWindowSize,
+		},
+		{
+			// 窗口大小为 1 时等待超时重传
+			name:      "resend after timeout",
+			size:      2000,
+			blockSize: 512,
+			window:    1,
+			drop:      dropOnce(2),
+		},
+		{
+			// 窗口中的数据块丢失时从客户端确认的下一个数据块开始重传
+			name:      "resend lost block in window",
+			size:      5000,
+			blockSize: 512,
+			window:    4,
+			drop:      dropOnce(3),
+		},
+		{
+			name:      "resend lost block after wrap",
+			size:      8*65600 + 1,
+			blockSize: 8,
+			window:    maxWindowSize,
+			drop:      dropOnce(65540),
+		},
+	}
+	for _, test := range tests {
+		drop := test.drop
+		if drop == nil {
+			drop = func(int64) bool { return false }
+		}
+		file := testFile(test.size)
+		client := newTestClient(t)
+		tr := newTestTransfer(t, client, file, test.blockSize, test.window)
+
+		done := make(chan error, 1)
+		go func() { done <- tr.run(&readRequest{}) }()
+		data := client.receive(test.blockSize, test.window, drop)
+
+		if err := <-done; err != nil {
+			t.Errorf("%s: run() error %s", test.name, err)
+		}
+		if !bytes.Equal(data, file) {
+			t.Errorf("%s: received %d bytes, want %d bytes", test.name, len(data), len(file))
+		}
+		if tr.sent != int64(len(file)) {
+			t.Errorf("%s: sent %d, want %d", test.name, tr.sent, len(file))
+		}
+	}
+}
+
+// 第 n 个数据块第一次发送时丢失
+func dropOnce(n int64) func(int64) bool {
+	dropped := false
+	return func(block int64) bool {
+		if block == n && !dropped {
+			dropped = true
+			return true
+		}
+		return false
+	}
+}
+
+func readRequestPacket(op uint16, fields ...string) []byte {
+	packet := make([]byte, 2)
+	binary.BigEndian.PutUint16(packet, op)
+	for _, field := range fields {
+		packet = append(packet, field...)
+		packet = append(packet, 0)
+	}
+	return packet
+}
+
+func TestHandleRequest(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := testFile(1500)
+	if err := os.WriteFile(filepath.Join(root, "pxelinux.0"), file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	localIP := net.IPv4(127, 0, 0, 1)
+
+	// 协商选项之后传输文件
+	client := newTestClient(t)
+	go handleRequest(root, localIP, client.conn.LocalAddr(), readRequestPacket(opRRQ, "pxelinux.0", "octet", "blksize", "1024", "tsize", "0"))
+	if op, packet := client.read(); op != opOACK || string(packet) != "blksize\x001024\x00tsize\x001500\x00" {
+		t.Fatalf("reply opcode %d %q, want OACK", op, packet)
+	}
+	client.ack(0)
+	if data := client.receive(1024, 1, func(int64) bool { return false }); !bytes.Equal(data, file) {
+		t.Errorf("received %d bytes, want %d bytes", len(data), len(file))
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		code   uint16
+	}{
+		{"path traversal", readRequestPacket(opRRQ, "../../etc/passwd", "octet"), errFileNotFound},
+		{"missing file", readRequestPacket(opRRQ, "missing", "octet"), errFileNotFound},
+		{"netascii", readRequestPacket(opRRQ, "pxelinux.0", "netascii"), errIllegalOperation},
+		{"write request", readRequestPacket(opWRQ, "pxelinux.0", "octet"), errAccessViolation},
+		{"malformed request", []byte{0, 1, 'a'}, errIllegalOperation},
+	}
+	for _, test := range tests {
+		client := newTestClient(t)
+		go handleRequest(root, localIP, client.conn.LocalAddr(), test.packet)
+		op, packet := client.read()
+		if code := binary.BigEndian.Uint16(packet); op != opERROR || code != test.code {
+			t.Errorf("%s: reply opcode %d code %d, want ERROR %d", test.name, op, code, test.code)
+		}
+	}
+}